@@ -0,0 +1,215 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Агрегатные функции над полями модели.
+// Все агрегаты выполняются одним запросом, NULL (например, AVG по пустой таблице)
+// возвращается как sql.NullFloat64 с Valid == false.
+
+type Aggregate struct {
+	Func  string  // COUNT, SUM, AVG, MIN, MAX, PERCENTILE
+	Field string  // поле модели, например "Age"; для COUNT можно не указывать
+	P     float64 // для PERCENTILE, от 0 до 1
+}
+
+func Count(field string) Aggregate { return Aggregate{Func: "COUNT", Field: field} }
+func Sum(field string) Aggregate   { return Aggregate{Func: "SUM", Field: field} }
+func Avg(field string) Aggregate   { return Aggregate{Func: "AVG", Field: field} }
+func Min(field string) Aggregate   { return Aggregate{Func: "MIN", Field: field} }
+func Max(field string) Aggregate   { return Aggregate{Func: "MAX", Field: field} }
+
+func Percentile(field string, p float64) Aggregate {
+	return Aggregate{Func: "PERCENTILE", Field: field, P: p}
+}
+
+// Результат одной строки: ключ - "avg_age", "count", "percentile_50_age" и т.д.
+type Stats map[string]sql.NullFloat64
+
+type Aggregation struct {
+	db         *gorm.DB
+	model      interface{}
+	aggregates []Aggregate
+	groupBy    []string
+	having     []havingCondition
+}
+
+type havingCondition struct {
+	query string
+	args  []interface{}
+}
+
+func NewAggregation(db *gorm.DB, model interface{}) *Aggregation {
+	return &Aggregation{db: db, model: model}
+}
+
+func (a *Aggregation) Select(aggregates ...Aggregate) *Aggregation {
+	a.aggregates = append(a.aggregates, aggregates...)
+	return a
+}
+
+func (a *Aggregation) GroupBy(fields ...string) *Aggregation {
+	a.groupBy = append(a.groupBy, fields...)
+	return a
+}
+
+// Условие на агрегаты, например Having("AVG(age) > ?", 20).
+// Несколько вызовов объединяются через AND.
+func (a *Aggregation) Having(query string, args ...interface{}) *Aggregation {
+	a.having = append(a.having, havingCondition{query, args})
+	return a
+}
+
+// Имя колонки результата для агрегата
+func (agg Aggregate) Alias(column string) string {
+	name := strings.ToLower(agg.Func)
+	if agg.Func == "PERCENTILE" {
+		name = fmt.Sprintf("percentile_%d", int(math.Round(agg.P*100)))
+	}
+	if column == "" {
+		return name
+	}
+	return name + "_" + column
+}
+
+func (a *Aggregation) query() (*gorm.DB, []string, []string, error) {
+	stmt := &gorm.Statement{DB: a.db}
+	if err := stmt.Parse(a.model); err != nil {
+		return nil, nil, nil, err
+	}
+
+	column := func(field string) (string, error) {
+		if f := stmt.Schema.LookUpField(field); f != nil && f.DBName != "" {
+			return f.DBName, nil
+		}
+		return "", fmt.Errorf("у модели %s нет поля %q", stmt.Schema.Name, field)
+	}
+
+	var selects, groups, aliases []string
+
+	for _, field := range a.groupBy {
+		name, err := column(field)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		groups = append(groups, name)
+		selects = append(selects, stmt.Quote(name))
+	}
+
+	for _, agg := range a.aggregates {
+		name, expr := "", "*"
+		if agg.Field != "" {
+			var err error
+			if name, err = column(agg.Field); err != nil {
+				return nil, nil, nil, err
+			}
+			expr = stmt.Quote(name)
+		}
+
+		alias := agg.Alias(name)
+		switch agg.Func {
+		case "PERCENTILE":
+			expr = fmt.Sprintf("PERCENTILE_CONT(%g) WITHIN GROUP (ORDER BY %s)", agg.P, expr)
+		default:
+			expr = fmt.Sprintf("%s(%s)", agg.Func, expr)
+		}
+
+		selects = append(selects, fmt.Sprintf("%s AS %s", expr, stmt.Quote(alias)))
+		aliases = append(aliases, alias)
+	}
+
+	tx := a.db.Model(a.model).Select(strings.Join(selects, ", "))
+	if len(groups) > 0 {
+		tx = tx.Group(strings.Join(groups, ", "))
+	}
+	for _, having := range a.having {
+		tx = tx.Having(having.query, having.args...)
+	}
+
+	return tx, groups, aliases, nil
+}
+
+// Строка результата с группировкой
+type Group struct {
+	Keys  []sql.NullString // значения полей GroupBy; NULL - Valid == false, не ""
+	Stats Stats
+}
+
+// Значения полей GroupBy через "|", NULL выводится как NULL
+func (g Group) String() string {
+	parts := make([]string, len(g.Keys))
+	for i, key := range g.Keys {
+		parts[i] = key.String
+		if !key.Valid {
+			parts[i] = "NULL"
+		}
+	}
+	return strings.Join(parts, "|")
+}
+
+// Группы в порядке, который вернула база
+func (a *Aggregation) Groups() ([]Group, error) {
+	tx, groups, aliases, err := a.query()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []Group
+	for rows.Next() {
+		keys := make([]sql.NullString, len(groups))
+		values := make([]sql.NullFloat64, len(aliases))
+
+		dest := make([]interface{}, 0, len(keys)+len(values))
+		for i := range keys {
+			dest = append(dest, &keys[i])
+		}
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		stats := Stats{}
+		for i, alias := range aliases {
+			stats[alias] = values[i]
+		}
+		result = append(result, Group{Keys: keys, Stats: stats})
+	}
+
+	return result, rows.Err()
+}
+
+// Без группировки - одна строка
+func (a *Aggregation) One() (Stats, error) {
+	groups, err := a.Groups()
+	if err != nil {
+		return nil, err
+	}
+	if len(groups) == 0 {
+		return Stats{}, nil
+	}
+	return groups[0].Stats, nil
+}
+
+// Результат в структуру: поля сопоставляются с псевдонимами (AvgAge -> avg_age).
+// Для NULL используйте *float64 или sql.NullFloat64.
+func (a *Aggregation) Scan(dest interface{}) error {
+	tx, _, _, err := a.query()
+	if err != nil {
+		return err
+	}
+	return tx.Scan(dest).Error
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&User{}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func TestAggregationNulls(t *testing.T) {
+	db := openTestDB(t)
+
+	stats, err := NewAggregation(db, &User{}).Select(Count(""), Avg("Age"), Min("Age")).One()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats["avg_age"].Valid || stats["min_age"].Valid || stats["count"].Float64 != 0 {
+		t.Errorf("пустая таблица: %v", stats)
+	}
+
+	db.Exec(`INSERT INTO users (name, email, age) VALUES
+		(NULL, 'a@example.com', 20), (NULL, 'b@example.com', 30),
+		('', 'c@example.com', 40),
+		('Ann', 'd@example.com', 50), ('Ann', 'e@example.com', 60)`)
+
+	groups, err := NewAggregation(db, &User{}).Select(Count(""), Avg("Age")).GroupBy("Name").Groups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := map[string]Stats{}
+	for _, group := range groups {
+		byName[group.String()] = group.Stats
+	}
+	for name, want := range map[string]float64{"NULL": 25, "": 40, "Ann": 55} {
+		if got := byName[name]["avg_age"]; !got.Valid || got.Float64 != want {
+			t.Errorf("группа %q: avg_age %v, ожидалось %v", name, got, want)
+		}
+	}
+	if len(groups) != 3 {
+		t.Errorf("групп %d, ожидалось 3: NULL и \"\" - разные группы", len(groups))
+	}
+}
+
+func TestAggregationHaving(t *testing.T) {
+	db := openTestDB(t)
+	db.Exec(`INSERT INTO users (name, email, age) VALUES
+		('a', 'a@example.com', 20), ('a', 'b@example.com', 22),
+		('b', 'c@example.com', 40), ('b', 'd@example.com', 42),
+		('c', 'e@example.com', 60)`)
+
+	groups, err := NewAggregation(db, &User{}).
+		Select(Count("")).
+		GroupBy("Name").
+		Having("COUNT(*) > ?", 1).
+		Having("AVG(age) > ?", 30).
+		Groups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 || groups[0].String() != "b" {
+		t.Errorf("оба условия Having должны действовать, группы: %v", groups)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -8,10 +9,11 @@ import (
 
 // Создаем модель данных (структуру)
 type User struct {
-	ID    uint   `gorm:"primaryKey"`
-	Name  string `gorm:"column:name"`
-	Email string `gorm:"column:email"`
-	Age   int    `gorm:"column:age"`
+	ID      uint    `gorm:"primaryKey"`
+	Name    string  `gorm:"column:name"`
+	Email   string  `gorm:"column:email"`
+	Age     int     `gorm:"column:age"`
+	Version Version `gorm:"column:version;not null;default:1"` // версия записи
 }
 
 func main() {
@@ -22,6 +24,9 @@ func main() {
 		panic("Не удалось подключиться к базе данных")
 	}
 
+	// Проверка версии при обновлении (оптимистическая блокировка)
+	db.Use(OptimisticLockPlugin{})
+
 	// Автомиграция - создание таблицы, если она не существует
 	db.AutoMigrate(&User{})
 
@@ -29,14 +34,25 @@ func main() {
 	user := User{Name: "Name", Email: "name@example.com", Age: 25}
 	db.Create(&user)
 
+	// Проверка данных перед сохранением
+	if err := db.Create(&User{Name: "", Email: "not-an-email", Age: 25}).Error; err != nil {
+		printValidationError(err)
+	}
+
 	// Чтение пользователя по ID
 	var readUser User
 	db.First(&readUser, user.ID)
 	fmt.Printf("ID: %d, Name: %s, Email: %s\n", readUser.ID, readUser.Name, readUser.Email)
 
 	// Обновление данных пользователя
+	staleUser := readUser
 	db.Model(&readUser).Update("Name", "Новое имя")
 
+	// Обновление устаревшей копии: версия уже изменилась
+	if err := db.Model(&staleUser).Update("Name", "Другое имя").Error; errors.Is(err, ErrConflict) {
+		fmt.Println("Конфликт:", err)
+	}
+
 	// Обновление по условию
 	db.Model(&User{}).Where("id = ?", 1).Update("Name", "Новое имя")
 	//или:
@@ -66,6 +82,19 @@ func main() {
 	db.Find(&users)
 	fmt.Println(users)
 
+	// Перебор всех записей курсором, без загрузки в слайс
+	// (обертка-итератор Stream[T] - в Project 2, stream.go):
+	if rows, err := db.Model(&User{}).Order("id").Rows(); err == nil {
+		for rows.Next() {
+			var user User
+			if err := db.ScanRows(rows, &user); err != nil {
+				break
+			}
+			fmt.Println(user)
+		}
+		rows.Close()
+	}
+
 	// Поиск нескольких записей с условиями:
 	db.Where("age > ?", 18).Find(&users)
 	fmt.Println(users)
@@ -100,15 +129,43 @@ func main() {
 	db.Model(&User{}).Count(&count)
 	fmt.Println("Всего человек:", count)
 
-	// Средний возраст
-	var averageAge float64
-	db.Model(&User{}).Select("AVG(age) as average_age").Scan(&averageAge)
-	fmt.Println("Средний возраст:", averageAge)
+	// Средний и минимальный возраст (на пустой таблице - NULL, Valid == false)
+	ages, err := NewAggregation(db, &User{}).Select(Avg("Age"), Min("Age")).One()
+	if err == nil && ages["avg_age"].Valid {
+		fmt.Println("Средний возраст:", ages["avg_age"].Float64)
+		fmt.Println("Самый молодой:", ages["min_age"].Float64)
+	}
+
+	// Несколько агрегатов одним запросом (NULL на пустой таблице -> Valid == false)
+	stats, err := NewAggregation(db, &User{}).
+		Select(Count(""), Avg("Age"), Min("Age"), Max("Age"), Percentile("Age", 0.5)).
+		One()
+	if err == nil && stats["avg_age"].Valid {
+		fmt.Println("Всего:", stats["count"].Float64, "Средний:", stats["avg_age"].Float64, "Медиана:", stats["percentile_50_age"].Float64)
+	}
 
-	// Минимальный возраст
-	var minAge float64
-	db.Model(&User{}).Select("MIN(age) as min_age").Scan(&minAge)
-	fmt.Println("Самый молодой:", minAge)
+	// Группировка с условием на агрегат
+	byAge, err := NewAggregation(db, &User{}).
+		Select(Count("")).
+		GroupBy("Age").
+		Having("COUNT(*) > ?", 1).
+		Groups()
+	if err == nil {
+		for _, group := range byAge {
+			fmt.Println("Возраст:", group, "Человек:", group.Stats["count"].Float64)
+		}
+	}
+
+	// Или в структуру
+	var ageStats struct {
+		AvgAge *float64
+		MinAge *float64
+		MaxAge *float64
+	}
+	err = NewAggregation(db, &User{}).Select(Avg("Age"), Min("Age"), Max("Age")).Scan(&ageStats)
+	if err == nil && ageStats.AvgAge != nil {
+		fmt.Printf("Возраст: средний %.1f, от %.0f до %.0f\n", *ageStats.AvgAge, *ageStats.MinAge, *ageStats.MaxAge)
+	}
 
 	//Пагинация
 	db.Order("id").Limit(2).Offset(2).Find(&users)
@@ -0,0 +1 @@
+../Project 2/optimistic.go
\ No newline at end of file
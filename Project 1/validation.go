@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Ошибки - *ValidationError (validationerror.go - ссылка на ../Project 2/validationerror.go)
+
+// Проверка одного поля User; field - имя поля в модели
+func validateUserField(result *ValidationError, field string, value interface{}) {
+	switch field {
+	case "Name":
+		if name, _ := value.(string); strings.TrimSpace(name) == "" {
+			result.Add(field, "обязательное поле")
+		}
+	case "Email":
+		email, _ := value.(string)
+		if address, err := mail.ParseAddress(email); err != nil || address.Address != email {
+			result.Add(field, "некорректный email")
+		}
+	case "Age":
+		if v := reflect.ValueOf(value); v.CanInt() && (v.Int() < 0 || v.Int() > 150) {
+			result.Add(field, fmt.Sprintf("недопустимый возраст %d", v.Int()))
+		}
+	}
+}
+
+func (u *User) Validate() error {
+	result := &ValidationError{}
+	validateUserField(result, "Name", u.Name)
+	validateUserField(result, "Email", u.Email)
+	validateUserField(result, "Age", u.Age)
+	return result.OrNil()
+}
+
+func (u *User) BeforeCreate(tx *gorm.DB) error {
+	return u.Validate()
+}
+
+// При обновлении проверяются только новые значения:
+// Update("email", ...) и Updates(map) - по имени поля или столбца,
+// Updates(User{...}) - ненулевые поля, Save - вся модель
+func (u *User) BeforeUpdate(tx *gorm.DB) error {
+	if tx.Statement.Dest == tx.Statement.Model {
+		return u.Validate()
+	}
+
+	result := &ValidationError{}
+	schema := tx.Statement.Schema
+
+	switch dest := tx.Statement.Dest.(type) {
+	case map[string]interface{}:
+		for key, value := range dest {
+			if field := schema.LookUpField(key); field != nil {
+				validateUserField(result, field.Name, value)
+			}
+		}
+	default:
+		v := reflect.Indirect(reflect.ValueOf(dest))
+		if v.Kind() != reflect.Struct || v.Type() != schema.ModelType {
+			return nil
+		}
+		for _, field := range schema.Fields {
+			if value, zero := field.ValueOf(tx.Statement.Context, v); !zero {
+				validateUserField(result, field.Name, value)
+			}
+		}
+	}
+
+	return result.OrNil()
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateUpdate(t *testing.T) {
+	db := openTestDB(t)
+	user := User{Name: "Name", Email: "name@example.com", Age: 25}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		err   error
+		field string
+	}{
+		{"Update по имени поля", db.Model(&User{ID: user.ID}).Update("Email", "bad").Error, "Email"},
+		{"Update по имени столбца", db.Model(&User{ID: user.ID}).Update("email", "bad").Error, "Email"},
+		{"Updates(map) по столбцу", db.Model(&User{ID: user.ID}).Updates(map[string]interface{}{"name": " "}).Error, "Name"},
+		{"Update возраста", db.Model(&User{ID: user.ID}).Update("age", 200).Error, "Age"},
+		{"Updates(struct)", db.Model(&User{ID: user.ID}).Updates(User{Email: "bad"}).Error, "Email"},
+		{"Updates(&struct)", db.Model(&User{ID: user.ID}).Updates(&User{Email: "bad"}).Error, "Email"},
+		{"Save", db.Save(&User{ID: user.ID, Name: "", Email: "name@example.com"}).Error, "Name"},
+	} {
+		var validationErr *ValidationError
+		if !errors.As(tc.err, &validationErr) || len(validationErr.Errors) != 1 || validationErr.Errors[0].Field != tc.field {
+			t.Errorf("%s: %v, ожидалась ошибка поля %s", tc.name, tc.err, tc.field)
+		}
+	}
+
+	// Нулевые поля в Updates(struct) не обновляются и не проверяются
+	if err := db.Model(&User{ID: user.ID}).Updates(User{Name: "Other"}).Error; err != nil {
+		t.Errorf("Updates(User{Name}): %v", err)
+	}
+
+	var saved User
+	db.First(&saved, user.ID)
+	if saved.Email != "name@example.com" || saved.Name != "Other" || saved.Age != 25 {
+		t.Errorf("сохранено %+v", saved)
+	}
+}
@@ -0,0 +1 @@
+../Project 2/validationerror.go
\ No newline at end of file
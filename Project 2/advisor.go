@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Советник по индексам: SQL каждой функции-запроса из main.go захватывается
+// в режиме DryRun (запрос не выполняется), затем для него выполняется EXPLAIN,
+// и в плане ищется последовательное чтение таблицы (Seq Scan / SCAN).
+//
+//	go run . advise
+//	go run . advise GetUserCommentCount FindMatchingEmails
+//
+// На маленьких таблицах планировщик выбирает Seq Scan и при наличии индекса -
+// так дешевле. Смотреть советы имеет смысл на базе с реальным объемом данных.
+
+// Функции-запросы по имени (для advise и explain)
+var queryHelpers = []struct {
+	name string
+	run  func(db *gorm.DB)
+}{
+	{"usersALL", func(db *gorm.DB) { usersALL(db) }},
+	{"usersPart", func(db *gorm.DB) { usersPart(db, 1) }},
+	{"usersByIDList", func(db *gorm.DB) { usersByIDList(db, []uint{1, 3, 5}) }},
+	{"GetUsersWithNoPosts", func(db *gorm.DB) { GetUsersWithNoPosts(db) }},
+	{"FindUsersWithoutPosts", func(db *gorm.DB) { FindUsersWithoutPosts(db) }},
+	{"GetPostCountByUser", func(db *gorm.DB) { GetPostCountByUser(db) }},
+	{"GetUserDataWithPostCount", func(db *gorm.DB) { GetUserDataWithPostCount(db) }},
+	{"GetUsersWithLimitAndOffset", func(db *gorm.DB) { GetUsersWithLimitAndOffset(db, 2, 2) }},
+	{"GetCommentsWithLimitAndOffset", func(db *gorm.DB) { GetCommentsWithLimitAndOffset(db, 10, 20) }},
+	{"GetUserCommentCount", func(db *gorm.DB) { GetUserCommentCount(db) }},
+	{"GetUserCommentPostData", func(db *gorm.DB) { GetUserCommentPostData(db) }},
+	{"FindTop3PostsPerUser", func(db *gorm.DB) { FindTop3PostsPerUser(db) }},
+	{"FindTopPostsPerUser", func(db *gorm.DB) { FindTopPostsPerUser(db, 3) }},
+	{"FindLatestCommentsPerPost", func(db *gorm.DB) { FindLatestCommentsPerPost(db, 2) }},
+	{"FindMatchingEmails", func(db *gorm.DB) { FindMatchingEmails(db) }},
+	{"FindCommentsByBodyKeyword", func(db *gorm.DB) { FindCommentsByBodyKeyword(db, "molestiae ") }},
+	{"GetUserEngagementReport", func(db *gorm.DB) { GetUserEngagementReport(db) }},
+}
+
+func findQueryHelper(name string) (func(db *gorm.DB), error) {
+	names := make([]string, 0, len(queryHelpers))
+	for _, helper := range queryHelpers {
+		if helper.name == name {
+			return helper.run, nil
+		}
+		names = append(names, helper.name)
+	}
+	return nil, fmt.Errorf("неизвестная функция %s, доступны: %s", name, strings.Join(names, ", "))
+}
+
+// SQL запроса с параметрами, как он ушел бы в базу.
+// Preloads - связи из Preload: их запросы строятся по ID найденных строк,
+// а в DryRun строк нет, поэтому SQL для них не захватывается
+type CapturedQuery struct {
+	SQL      string
+	Vars     []interface{}
+	Preloads []string
+}
+
+// Предупреждение о связях, запросы которых не попали в разбор
+func (q CapturedQuery) preloadWarning() string {
+	if len(q.Preloads) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("запросы Preload(%s) не захвачены: в DryRun они не строятся", strings.Join(q.Preloads, ", "))
+}
+
+type capturedQueriesKey struct{}
+
+// Плагин записывает SQL запросов, в контексте которых есть список
+type queryCapture struct{}
+
+func (queryCapture) Name() string {
+	return "query_capture"
+}
+
+func (c queryCapture) Initialize(db *gorm.DB) error {
+	if err := db.Callback().Query().After("gorm:query").Register("query_capture:query", c.record); err != nil {
+		return err
+	}
+	return db.Callback().Row().After("gorm:row").Register("query_capture:row", c.record)
+}
+
+func (queryCapture) record(db *gorm.DB) {
+	queries, ok := db.Statement.Context.Value(capturedQueriesKey{}).(*[]CapturedQuery)
+	if !ok || db.Statement.SQL.Len() == 0 {
+		return
+	}
+
+	preloads := make([]string, 0, len(db.Statement.Preloads))
+	for name := range db.Statement.Preloads {
+		preloads = append(preloads, name)
+	}
+	sort.Strings(preloads)
+	*queries = append(*queries, CapturedQuery{SQL: db.Statement.SQL.String(), Vars: db.Statement.Vars, Preloads: preloads})
+}
+
+// SQL, который функция строит в DryRun; в базу он не отправляется.
+// Это не все запросы функции: DryRun не возвращает строк, поэтому запросы,
+// зависящие от результата (Preload, циклы по найденным записям), не строятся -
+// для Preload имена связей сохраняются в CapturedQuery.Preloads.
+// Вывод функции при этом пустой, а Scan завершается ошибкой
+// ErrDryRunModeUnsupported - после того, как SQL построен.
+func captureQueries(db *gorm.DB, run func(db *gorm.DB)) ([]CapturedQuery, error) {
+	if err := db.Use(queryCapture{}); err != nil && !errors.Is(err, gorm.ErrRegistered) {
+		return nil, err
+	}
+
+	var queries []CapturedQuery
+	ctx := context.WithValue(db.Statement.Context, capturedQueriesKey{}, &queries)
+	run(db.Session(&gorm.Session{DryRun: true, Context: ctx, Logger: db.Logger.LogMode(logger.Silent)}))
+	return queries, nil
+}
+
+// Узел плана Postgres (EXPLAIN FORMAT JSON); Actual* и буферы -
+// только с ANALYZE и BUFFERS (explain.go)
+type PlanNode struct {
+	NodeType            string     `json:"Node Type"`
+	JoinType            string     `json:"Join Type"`
+	RelationName        string     `json:"Relation Name"`
+	Alias               string     `json:"Alias"`
+	IndexName           string     `json:"Index Name"`
+	IndexCond           string     `json:"Index Cond"`
+	Filter              string     `json:"Filter"`
+	JoinFilter          string     `json:"Join Filter"`
+	HashCond            string     `json:"Hash Cond"`
+	MergeCond           string     `json:"Merge Cond"`
+	SortKey             []string   `json:"Sort Key"`
+	StartupCost         float64    `json:"Startup Cost"`
+	TotalCost           float64    `json:"Total Cost"`
+	PlanRows            float64    `json:"Plan Rows"`
+	ActualTotalTime     float64    `json:"Actual Total Time"`
+	ActualRows          float64    `json:"Actual Rows"`
+	ActualLoops         float64    `json:"Actual Loops"`
+	RowsRemovedByFilter float64    `json:"Rows Removed by Filter"`
+	SharedHitBlocks     int64      `json:"Shared Hit Blocks"`
+	SharedReadBlocks    int64      `json:"Shared Read Blocks"`
+	Plans               []PlanNode `json:"Plans"`
+}
+
+func (n PlanNode) walk(fn func(node PlanNode)) {
+	fn(n)
+	for _, child := range n.Plans {
+		child.walk(fn)
+	}
+}
+
+// Последовательное чтение таблицы в плане запроса
+type SeqScan struct {
+	Table  string
+	Filter string
+	Rows   float64
+	Cost   float64
+}
+
+// Таблица и псевдоним во FROM/JOIN: "posts p", "users AS u"
+var tableAliasPattern = regexp.MustCompile("(?i)\\b(?:FROM|JOIN)\\s+[\"`]?(\\w+)[\"`]?(?:\\s+(?:AS\\s+)?[\"`]?(\\w+))?")
+
+// SQLite: EXPLAIN QUERY PLAN, "SCAN t" - чтение всей таблицы, "SEARCH t USING INDEX" - по индексу.
+// В плане - псевдонимы: "SCAN p" может быть таблицей posts p или подзапросом
+// (SELECT ...) p, который план показывает строкой CO-ROUTINE p или MATERIALIZE p.
+// Чтение подзапроса - не чтение таблицы, в отчет попадают только таблицы базы.
+func sqliteSeqScans(db *gorm.DB, query CapturedQuery) ([]SeqScan, error) {
+	names, err := db.Migrator().GetTables()
+	if err != nil {
+		return nil, err
+	}
+	tables := map[string]bool{}
+	for _, name := range names {
+		tables[name] = true
+	}
+	aliases := map[string]string{}
+	for _, match := range tableAliasPattern.FindAllStringSubmatch(query.SQL, -1) {
+		if tables[match[1]] && match[2] != "" {
+			aliases[match[2]] = match[1]
+		}
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := sqlDB.Query("EXPLAIN QUERY PLAN "+query.SQL, query.Vars...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type planRow struct {
+		id, parent int
+		detail     string
+	}
+	var plan []planRow
+	parents := map[int]int{}
+	subqueries := map[string][]int{} // имя подзапроса -> id строк CO-ROUTINE/MATERIALIZE
+	for rows.Next() {
+		var row planRow
+		var notUsed int
+		if err := rows.Scan(&row.id, &row.parent, &notUsed, &row.detail); err != nil {
+			return nil, err
+		}
+		plan = append(plan, row)
+		parents[row.id] = row.parent
+		for _, prefix := range []string{"CO-ROUTINE ", "MATERIALIZE "} {
+			if name, ok := strings.CutPrefix(row.detail, prefix); ok {
+				subqueries[name] = append(subqueries[name], row.id)
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Строка плана внутри подзапроса ancestor
+	inside := func(id, ancestor int) bool {
+		for id != 0 {
+			if id = parents[id]; id == ancestor {
+				return true
+			}
+		}
+		return false
+	}
+
+	var scans []SeqScan
+	for _, row := range plan {
+		name, ok := strings.CutPrefix(row.detail, "SCAN ")
+		// SCAN (subquery-N) - чтение уже посчитанного подзапроса, не таблицы
+		if !ok || strings.HasPrefix(name, "(") || strings.Contains(name, " USING ") {
+			continue
+		}
+		// SCAN p снаружи CO-ROUTINE p - чтение подзапроса p
+		derived := false
+		for _, id := range subqueries[name] {
+			if !inside(row.id, id) {
+				derived = true
+			}
+		}
+		if derived {
+			continue
+		}
+
+		switch {
+		case tables[name]:
+			scans = append(scans, SeqScan{Table: name})
+		case tables[aliases[name]]:
+			scans = append(scans, SeqScan{Table: aliases[name]})
+		}
+	}
+	return scans, nil
+}
+
+func explainSeqScans(db *gorm.DB, query CapturedQuery) ([]SeqScan, error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	if db.Dialector.Name() != "postgres" {
+		return sqliteSeqScans(db, query)
+	}
+
+	var plan []byte
+	if err := sqlDB.QueryRow("EXPLAIN (FORMAT JSON) "+query.SQL, query.Vars...).Scan(&plan); err != nil {
+		return nil, err
+	}
+	var explained []struct {
+		Plan PlanNode `json:"Plan"`
+	}
+	if err := json.Unmarshal(plan, &explained); err != nil {
+		return nil, err
+	}
+
+	var scans []SeqScan
+	for _, e := range explained {
+		e.Plan.walk(func(node PlanNode) {
+			if node.NodeType == "Seq Scan" {
+				scans = append(scans, SeqScan{Table: node.RelationName, Filter: node.Filter, Rows: node.PlanRows, Cost: node.TotalCost})
+			}
+		})
+	}
+	return scans, nil
+}
+
+func adviseCommand(db *gorm.DB, args []string) error {
+	names := args
+	if len(names) == 0 {
+		for _, helper := range queryHelpers {
+			names = append(names, helper.name)
+		}
+	}
+
+	flagged := map[string]int{}
+	for _, name := range names {
+		run, err := findQueryHelper(name)
+		if err != nil {
+			return err
+		}
+		queries, err := captureQueries(db, run)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%s (запросов: %d)\n", name, len(queries))
+		for _, query := range queries {
+			if warning := query.preloadWarning(); warning != "" {
+				fmt.Println("  " + warning)
+			}
+			scans, err := explainSeqScans(db, query)
+			if err != nil {
+				fmt.Printf("  EXPLAIN: %v\n", err)
+				continue
+			}
+			for _, scan := range scans {
+				flagged[scan.Table]++
+				fmt.Printf("  Seq Scan %s", scan.Table)
+				if scan.Filter != "" {
+					fmt.Printf(", фильтр: %s", scan.Filter)
+				}
+				if scan.Cost > 0 {
+					fmt.Printf(", строк ~%.0f, стоимость %.2f", scan.Rows, scan.Cost)
+				}
+				fmt.Println()
+			}
+		}
+	}
+
+	if len(flagged) == 0 {
+		fmt.Println("\nПоследовательных чтений нет.")
+		return nil
+	}
+
+	tables := make([]string, 0, len(flagged))
+	for table := range flagged {
+		tables = append(tables, table)
+	}
+	sort.Slice(tables, func(i, j int) bool {
+		return flagged[tables[i]] > flagged[tables[j]]
+	})
+	fmt.Println("\nТаблицы, читаемые целиком:")
+	for _, table := range tables {
+		fmt.Printf("  %s: %d\n", table, flagged[table])
+	}
+	return nil
+}
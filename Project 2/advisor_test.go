@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCaptureQueriesPreloads(t *testing.T) {
+	db := openTestDB(t, &User{})
+
+	capture := func(name string) []CapturedQuery {
+		t.Helper()
+		run, err := findQueryHelper(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		queries, err := captureQueries(db, run)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return queries
+	}
+
+	queries := capture("usersALL")
+	if len(queries) != 1 || !strings.Contains(queries[0].SQL, "users") {
+		t.Fatalf("захвачено %+v", queries)
+	}
+	// Запросы Preload в DryRun не строятся - остаются только имена связей
+	if want := []string{"Address", "Company"}; !reflect.DeepEqual(queries[0].Preloads, want) {
+		t.Errorf("Preloads %v, ожидалось %v", queries[0].Preloads, want)
+	}
+	if queries[0].preloadWarning() == "" {
+		t.Error("нет предупреждения о Preload")
+	}
+
+	for _, query := range capture("GetUserCommentCount") {
+		if query.preloadWarning() != "" {
+			t.Errorf("лишнее предупреждение: %s", query.preloadWarning())
+		}
+	}
+}
+
+func TestExplainSeqScansSQLite(t *testing.T) {
+	db := openTestDB(t, &User{}, &Post{}, &Comment{})
+
+	for _, tc := range []struct {
+		sql  string
+		want []string
+	}{
+		{"SELECT * FROM users u WHERE u.name = ?", []string{"users"}},
+		{"SELECT * FROM users AS u JOIN posts p ON p.user_id = u.id", []string{"posts"}},
+		{"SELECT * FROM users WHERE id = ?", nil},
+		// Подзапрос c снаружи - не таблица, внутри c - это comments
+		{`SELECT * FROM (SELECT c.*, ROW_NUMBER() OVER (PARTITION BY email ORDER BY id) AS rn FROM comments c) c
+			JOIN posts p ON p.id = c.post_id WHERE c.rn <= 3`, []string{"comments"}},
+	} {
+		scans, err := explainSeqScans(db, CapturedQuery{SQL: tc.sql, Vars: []interface{}{1}[:strings.Count(tc.sql, "?")]})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, scan := range scans {
+			got = append(got, scan.Table)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: %v, ожидалось %v", tc.sql, got, tc.want)
+		}
+	}
+
+	// Запросы из main.go: в отчете только таблицы базы
+	tables := map[string]bool{"users": true, "posts": true, "comments": true, "user_addresses": true, "user_companies": true}
+	for _, name := range []string{"FindTop3PostsPerUser", "GetUserCommentCount"} {
+		run, err := findQueryHelper(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		queries, _ := captureQueries(db.WithContext(WithoutTenant(context.Background())), run)
+		for _, query := range queries {
+			scans, err := explainSeqScans(db, query)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			for _, scan := range scans {
+				if !tables[scan.Table] {
+					t.Errorf("%s: Seq Scan %s - не таблица", name, scan.Table)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"gorm.io/gorm"
+)
+
+// Обработчики API, изменяющие данные. Маршруты и трассировка - в tracing.go
+// (serveTracedAPI), изменение поста с авторизацией - в auth.go (serveAuthAPI).
+
+// Изменение поста без версии не принимается: без нее нельзя проверить,
+// что клиент видел последнее состояние поста (оптимистическая блокировка)
+var ErrVersionRequired = errors.New("нужна версия поста (version), которую читал клиент")
+
+// Тело PUT /posts/{id}
+type PostInput struct {
+	Title   string  `json:"title"`
+	Body    string  `json:"body"`
+	Version Version `json:"version"`
+}
+
+// Код ответа по ошибке GORM и плагинов
+func writeAPIError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.Error(w, "не найдено", http.StatusNotFound)
+	case errors.Is(err, ErrConflict):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, ErrVersionRequired):
+		http.Error(w, err.Error(), http.StatusPreconditionRequired)
+	default:
+		if !writeValidationError(w, err) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// Пост после изменения, как он сохранен в базе (с новой версией).
+// Если изменить не удалось, а поста уже нет - ErrRecordNotFound вместо ErrConflict.
+func reloadPost(db *gorm.DB, id uint, updateErr error) (Post, error) {
+	var post Post
+	err := db.First(&post, id).Error
+	if updateErr != nil && !(errors.Is(updateErr, ErrConflict) && errors.Is(err, gorm.ErrRecordNotFound)) {
+		return post, updateErr
+	}
+	return post, err
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+// POST /users: при ошибках проверки - 422 и список ошибок по полям
+func createUserHandler(db *gorm.DB) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var user User
+		if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := db.WithContext(r.Context()).Create(&user).Error; err != nil {
+			writeAPIError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, user)
+	})
+}
+
+// PUT /posts/{id}: клиент передает версию, которую он читал.
+// Без версии - 428, если пост успели изменить - 409 Conflict.
+func updatePostHandler(db *gorm.DB) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := pathID(r)
+		if err != nil {
+			http.Error(w, "некорректный id", http.StatusBadRequest)
+			return
+		}
+		var input PostInput
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if input.Version <= 0 {
+			writeAPIError(w, ErrVersionRequired)
+			return
+		}
+
+		tx := db.WithContext(r.Context())
+		err = tx.Model(&Post{ID: id, Version: input.Version}).Updates(map[string]interface{}{
+			"title": input.Title,
+			"body":  input.Body,
+		}).Error
+
+		post, err := reloadPost(tx, id, err)
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, post)
+	})
+}
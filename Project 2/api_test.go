@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUpdatePost(t *testing.T) {
+	db := openTestDB(t, &Post{})
+	if err := db.Use(OptimisticLockPlugin{}); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&Post{UserID: 1, Title: "title", Body: "body"})
+
+	mux := http.NewServeMux()
+	mux.Handle("PUT /posts/{id}", updatePostHandler(db))
+	put := func(path, body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httptest.NewRequest("PUT", path, strings.NewReader(body)))
+		return recorder
+	}
+
+	for _, tc := range []struct {
+		name string
+		body string
+		code int
+	}{
+		{"без версии", `{"title":"new","body":"new"}`, http.StatusPreconditionRequired},
+		{"нулевая версия", `{"title":"new","body":"new","version":0}`, http.StatusPreconditionRequired},
+		{"некорректный JSON", `{"title":`, http.StatusBadRequest},
+		{"устаревшая версия", `{"title":"new","body":"new","version":5}`, http.StatusConflict},
+	} {
+		if recorder := put("/posts/1", tc.body); recorder.Code != tc.code {
+			t.Errorf("%s: код %d, ожидался %d: %s", tc.name, recorder.Code, tc.code, recorder.Body)
+		}
+	}
+	if recorder := put("/posts/999", `{"title":"new","body":"new","version":1}`); recorder.Code != http.StatusNotFound {
+		t.Errorf("несуществующий пост: код %d", recorder.Code)
+	}
+
+	var post Post
+	db.First(&post, 1)
+	if post.Title != "title" || post.Version != 1 {
+		t.Fatalf("пост изменен отклоненными запросами: %+v", post)
+	}
+
+	recorder := put("/posts/1", `{"title":"new","body":"new body","version":1}`)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("код %d: %s", recorder.Code, recorder.Body)
+	}
+	if err := json.NewDecoder(recorder.Body).Decode(&post); err != nil {
+		t.Fatal(err)
+	}
+	if post.Version != 2 || post.Title != "new" || post.Body != "new body" || post.UserID != 1 {
+		t.Errorf("в ответе не сохраненный пост: %+v", post)
+	}
+
+	// Повтор с прочитанной ранее версией - конфликт
+	if recorder := put("/posts/1", `{"title":"again","body":"again","version":1}`); recorder.Code != http.StatusConflict {
+		t.Errorf("повтор со старой версией: код %d", recorder.Code)
+	}
+}
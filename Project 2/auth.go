@@ -0,0 +1,466 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/term"
+	"gorm.io/gorm"
+)
+
+// Вход по Username или Email и паролю. Пароли хранятся bcrypt-хешем
+// в user_credentials, после входа выдается токен сессии (Bearer).
+// В базе хранится только SHA-256 токена: утечка таблицы не дает войти.
+//
+// Права: пост и комментарии к нему может менять только автор поста
+// (Post.UserID) или пользователь с ролью admin. Проверка в обработчике
+// (authorizePost) работает в любой базе и дает ответы 404 и 403.
+// В Postgres изменения дополнительно выполняются в AsUser под политиками
+// row-level security (rls.go) с тем же правилом - они защищают и от
+// db.Raw/db.Exec в обход проверки. Нужны go run . rls install
+// и подключение под ролью без обхода RLS.
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+const sessionTTL = 24 * time.Hour
+
+var (
+	ErrInvalidCredentials = errors.New("неверный логин или пароль")
+	ErrUnauthenticated    = errors.New("требуется вход")
+	ErrForbidden          = errors.New("недостаточно прав")
+)
+
+type UserCredential struct {
+	ID           uint   `gorm:"primaryKey"`
+	UserID       uint   `gorm:"uniqueIndex"` // Внешний ключ
+	PasswordHash string `json:"-"`
+	Role         string `gorm:"default:user"`
+	UpdatedAt    time.Time
+}
+
+type AuthSession struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"index"`
+	TokenHash string `gorm:"uniqueIndex"`
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+// Текущий пользователь запроса
+type Principal struct {
+	UserID uint
+	Role   string
+}
+
+type principalKey struct{}
+
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
+
+// Установка (или смена) пароля и роли пользователя
+func setPassword(db *gorm.DB, userID uint, password, role string) error {
+	if len(password) < 8 {
+		return errors.New("пароль должен быть не короче 8 символов")
+	}
+	if role != RoleUser && role != RoleAdmin {
+		return fmt.Errorf("неизвестная роль %q", role)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	credential := UserCredential{UserID: userID}
+	return db.Where(credential).
+		Assign(UserCredential{PasswordHash: string(hash), Role: role}).
+		FirstOrCreate(&credential).Error
+}
+
+// Хеш для сравнения, когда пользователя нет: время ответа не выдает,
+// существует ли логин
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+	return hash
+})
+
+// Проверка пароля и выдача токена сессии
+func login(db *gorm.DB, name, password string) (string, time.Time, error) {
+	var user User
+	var credential UserCredential
+
+	err := db.Where("username = ? OR email = ?", name, name).First(&user).Error
+	if err == nil {
+		err = db.Where("user_id = ?", user.ID).First(&credential).Error
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+		return "", time.Time{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(credential.PasswordHash), []byte(password)) != nil {
+		return "", time.Time{}, ErrInvalidCredentials
+	}
+
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", time.Time{}, err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(token)
+
+	session := AuthSession{
+		UserID:    user.ID,
+		TokenHash: hashToken(encoded),
+		ExpiresAt: time.Now().Add(sessionTTL),
+	}
+	if err := db.Create(&session).Error; err != nil {
+		return "", time.Time{}, err
+	}
+
+	// Заодно удаляем просроченные сессии
+	db.Where("expires_at < ?", time.Now()).Delete(&AuthSession{})
+
+	return encoded, session.ExpiresAt, nil
+}
+
+func logout(db *gorm.DB, token string) error {
+	return db.Where("token_hash = ?", hashToken(token)).Delete(&AuthSession{}).Error
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Пользователь по токену сессии; сессия действует только у арендатора
+// пользователя (X-Tenant-ID, tenancy.go)
+func authenticate(db *gorm.DB, token string) (Principal, error) {
+	var principal Principal
+	err := db.Model(&AuthSession{}).
+		Select("auth_sessions.user_id, COALESCE(user_credentials.role, ?) AS role", RoleUser).
+		Joins("JOIN users ON users.id = auth_sessions.user_id").
+		Joins("LEFT JOIN user_credentials ON user_credentials.user_id = auth_sessions.user_id").
+		Scopes(TenantScope("users")).
+		Where("auth_sessions.token_hash = ? AND auth_sessions.expires_at > ?", hashToken(token), time.Now()).
+		Take(&principal).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return Principal{}, ErrUnauthenticated
+	}
+	return principal, err
+}
+
+func bearerToken(r *http.Request) string {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// Пропускает только запросы с действующим токеном
+func requireAuth(db *gorm.DB, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := bearerToken(r)
+		if token == "" {
+			writeAuthError(w, ErrUnauthenticated)
+			return
+		}
+
+		principal, err := authenticate(db.WithContext(r.Context()), token)
+		if err != nil {
+			writeAuthError(w, err)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, principal)))
+	})
+}
+
+// Пост и его комментарии может менять автор или администратор -
+// то же правило, что в app_can_edit_post (rls.go)
+func authorizePost(tx *gorm.DB, principal Principal, postID uint) error {
+	var post Post
+	if err := tx.Select("id", "user_id").First(&post, postID).Error; err != nil {
+		return err
+	}
+	if principal.Role != RoleAdmin && post.UserID != principal.UserID {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// Изменения от имени пользователя: в Postgres - в AsUser под политиками RLS,
+// в остальных базах - в обычной транзакции, права проверяет только authorizePost
+func asPrincipal(ctx context.Context, db *gorm.DB, principal Principal, fn func(tx *gorm.DB) error) error {
+	if db.Dialector.Name() != "postgres" {
+		return db.WithContext(ctx).Transaction(fn)
+	}
+	return AsUser(ctx, db, principal.UserID, fn)
+}
+
+func writeAuthError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidCredentials), errors.Is(err, ErrUnauthenticated):
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	case errors.Is(err, ErrForbidden):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		writeAPIError(w, err)
+	}
+}
+
+func pathID(r *http.Request) (uint, error) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	return uint(id), err
+}
+
+// Вход и изменение постов и комментариев с проверкой прав
+func newAuthMux(db *gorm.DB) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /login", func(w http.ResponseWriter, r *http.Request) {
+		var input struct {
+			Login    string `json:"login"` // Username или Email
+			Password string `json:"password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		token, expiresAt, err := login(db.WithContext(r.Context()), input.Login, input.Password)
+		if err != nil {
+			writeAuthError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"token":      token,
+			"expires_at": expiresAt,
+		})
+	})
+
+	mux.Handle("POST /logout", requireAuth(db, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := logout(db.WithContext(r.Context()), bearerToken(r)); err != nil {
+			writeAuthError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})))
+
+	mux.Handle("PUT /posts/{id}", requireAuth(db, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ := PrincipalFrom(r.Context())
+		id, err := pathID(r)
+		if err != nil {
+			http.Error(w, "некорректный id", http.StatusBadRequest)
+			return
+		}
+
+		var input PostInput
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if input.Version <= 0 {
+			writeAuthError(w, ErrVersionRequired)
+			return
+		}
+
+		var post Post
+		err = asPrincipal(r.Context(), db, principal, func(tx *gorm.DB) error {
+			if err := authorizePost(tx, principal, id); err != nil {
+				return err
+			}
+			err := tx.Model(&Post{ID: id, Version: input.Version}).
+				Updates(map[string]interface{}{"title": input.Title, "body": input.Body}).Error
+			post, err = reloadPost(tx, id, err)
+			return err
+		})
+		if err != nil {
+			writeAuthError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, post)
+	})))
+
+	mux.Handle("DELETE /posts/{id}", requireAuth(db, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ := PrincipalFrom(r.Context())
+		id, err := pathID(r)
+		if err != nil {
+			http.Error(w, "некорректный id", http.StatusBadRequest)
+			return
+		}
+
+		err = asPrincipal(r.Context(), db, principal, func(tx *gorm.DB) error {
+			if err := authorizePost(tx, principal, id); err != nil {
+				return err
+			}
+			if err := tx.Where("post_id = ?", id).Delete(&Comment{}).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&Post{}, id).Error
+		})
+		if err != nil {
+			writeAuthError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})))
+
+	mux.Handle("PUT /comments/{id}", requireAuth(db, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ := PrincipalFrom(r.Context())
+		id, err := pathID(r)
+		if err != nil {
+			http.Error(w, "некорректный id", http.StatusBadRequest)
+			return
+		}
+
+		var input struct {
+			Name string `json:"name"`
+			Body string `json:"body"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var comment Comment
+		err = asPrincipal(r.Context(), db, principal, func(tx *gorm.DB) error {
+			if err := tx.First(&comment, id).Error; err != nil {
+				return err
+			}
+			if err := authorizePost(tx, principal, comment.PostID); err != nil {
+				return err
+			}
+			return tx.Model(&comment).Updates(map[string]interface{}{"name": input.Name, "body": input.Body}).Error
+		})
+		if err != nil {
+			writeAuthError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, comment)
+	})))
+
+	mux.Handle("DELETE /comments/{id}", requireAuth(db, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ := PrincipalFrom(r.Context())
+		id, err := pathID(r)
+		if err != nil {
+			http.Error(w, "некорректный id", http.StatusBadRequest)
+			return
+		}
+
+		err = asPrincipal(r.Context(), db, principal, func(tx *gorm.DB) error {
+			var comment Comment
+			if err := tx.First(&comment, id).Error; err != nil {
+				return err
+			}
+			if err := authorizePost(tx, principal, comment.PostID); err != nil {
+				return err
+			}
+			return tx.Delete(&comment).Error
+		})
+		if err != nil {
+			writeAuthError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})))
+
+	return tenantMiddleware(mux)
+}
+
+func serveAuthAPI(db *gorm.DB, addr string) {
+	fmt.Printf("API с авторизацией на http://localhost%s (POST /login)\n", addr)
+	if err := http.ListenAndServe(addr, newAuthMux(db)); err != nil {
+		panic("Не удалось запустить HTTP сервер")
+	}
+}
+
+// go run . passwd -login=Bret [-role=admin]
+// Пароль вводится в терминале без эха или читается из stdin:
+//
+//	echo 'secret123' | go run . passwd -login=Bret
+//
+// Флаг -password не используется: он попал бы в историю shell и в ps.
+func passwdCommand(db *gorm.DB, args []string) error {
+	flags := flag.NewFlagSet("passwd", flag.ExitOnError)
+	name := flags.String("login", "", "Username или Email пользователя")
+	role := flags.String("role", RoleUser, "роль: user или admin")
+	flags.Parse(args)
+
+	var user User
+	if err := db.Where("username = ? OR email = ?", *name, *name).First(&user).Error; err != nil {
+		return fmt.Errorf("пользователь %q: %w", *name, err)
+	}
+
+	password, err := readPassword(os.Stdin, os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	if err := db.AutoMigrate(&UserCredential{}, &AuthSession{}); err != nil {
+		return err
+	}
+	if err := setPassword(db, user.ID, password, *role); err != nil {
+		return err
+	}
+
+	fmt.Printf("Пароль пользователя %s (id %d) установлен, роль %s\n", user.Username, user.ID, *role)
+	return nil
+}
+
+// Пароль из терминала (дважды, без эха) или первая строка stdin
+func readPassword(in *os.File, prompt io.Writer) (string, error) {
+	fd := int(in.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := bufio.NewReader(in).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	fmt.Fprint(prompt, "Новый пароль: ")
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(prompt)
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Fprint(prompt, "Повторите пароль: ")
+	repeat, err := term.ReadPassword(fd)
+	fmt.Fprintln(prompt)
+	if err != nil {
+		return "", err
+	}
+	if string(password) != string(repeat) {
+		return "", errors.New("пароли не совпадают")
+	}
+	return string(password), nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestReadPasswordStdin(t *testing.T) {
+	for _, tc := range []struct {
+		input, want string
+	}{
+		{"secret123\n", "secret123"},
+		{"secret123\r\nignored\n", "secret123"},
+		{"no newline", "no newline"},
+		{"", ""},
+	} {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, tc.input)
+		w.Close()
+
+		password, err := readPassword(r, io.Discard)
+		r.Close()
+		if err != nil || password != tc.want {
+			t.Errorf("%q: %q, %v; ожидалось %q", tc.input, password, err, tc.want)
+		}
+	}
+}
+
+func openAuthTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	return openTestDB(t, &User{}, &Post{}, &Comment{}, &OutboxEvent{}, &UserCredential{}, &AuthSession{})
+}
+
+func createAuthUser(t *testing.T, db *gorm.DB, username, role string) User {
+	t.Helper()
+	user := User{Name: username, Username: username, Email: strings.ToLower(username) + "@example.com"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := setPassword(db, user.ID, username+" password", role); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestLogin(t *testing.T) {
+	db := openAuthTestDB(t)
+	user := createAuthUser(t, db, "Bret", RoleUser)
+
+	if err := setPassword(db, user.ID, "short", RoleUser); err == nil {
+		t.Error("короткий пароль принят")
+	}
+
+	for _, tc := range []struct{ login, password string }{
+		{"Bret", "wrong password"},
+		{"Nobody", "Bret password"},
+	} {
+		if _, _, err := login(db, tc.login, tc.password); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("%s/%s: %v", tc.login, tc.password, err)
+		}
+	}
+
+	// Вход по Username и по Email
+	for _, name := range []string{"Bret", "bret@example.com"} {
+		token, expiresAt, err := login(db, name, "Bret password")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if time.Until(expiresAt) < sessionTTL-time.Minute {
+			t.Errorf("сессия до %v", expiresAt)
+		}
+
+		principal, err := authenticate(db, token)
+		if err != nil || principal != (Principal{UserID: user.ID, Role: RoleUser}) {
+			t.Errorf("%s: %+v, %v", name, principal, err)
+		}
+
+		// После выхода токен не действует
+		if err := logout(db, token); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := authenticate(db, token); !errors.Is(err, ErrUnauthenticated) {
+			t.Errorf("%s после выхода: %v", name, err)
+		}
+	}
+
+	// В базе только хеш токена
+	token, _, _ := login(db, "Bret", "Bret password")
+	var stored int64
+	db.Model(&AuthSession{}).Where("token_hash = ?", token).Count(&stored)
+	if stored != 0 {
+		t.Error("токен хранится в открытом виде")
+	}
+}
+
+func TestSessionExpiry(t *testing.T) {
+	db := openAuthTestDB(t)
+	createAuthUser(t, db, "Bret", RoleUser)
+
+	token, _, err := login(db, "Bret", "Bret password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Model(&AuthSession{}).Where("token_hash = ?", hashToken(token)).Update("expires_at", time.Now().Add(-time.Minute))
+
+	if _, err := authenticate(db, token); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("просроченная сессия: %v", err)
+	}
+
+	// Следующий вход удаляет просроченные сессии
+	if _, _, err := login(db, "Bret", "Bret password"); err != nil {
+		t.Fatal(err)
+	}
+	var expired int64
+	db.Model(&AuthSession{}).Where("expires_at < ?", time.Now()).Count(&expired)
+	if expired != 0 {
+		t.Errorf("просроченных сессий: %d", expired)
+	}
+}
+
+// Права проверяются в обработчике - в SQLite без RLS тоже
+func TestAuthAPIOwnership(t *testing.T) {
+	db := openAuthTestDB(t)
+	if err := db.Use(OptimisticLockPlugin{}); err != nil {
+		t.Fatal(err)
+	}
+	owner := createAuthUser(t, db, "Owner", RoleUser)
+	createAuthUser(t, db, "Other", RoleUser)
+	createAuthUser(t, db, "Root", RoleAdmin)
+
+	post := Post{UserID: owner.ID, Title: "owner post", Comments: []Comment{{Body: "first"}, {Body: "second"}}}
+	if err := db.Create(&post).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	mux := newAuthMux(db)
+	request := func(method, path, token, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("X-Tenant-ID", "team_a")
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, r)
+		return recorder
+	}
+	tokenOf := func(name string) string {
+		t.Helper()
+		recorder := request("POST", "/login", "", fmt.Sprintf(`{"login": %q, "password": %q}`, name, name+" password"))
+		var response struct {
+			Token string `json:"token"`
+		}
+		if recorder.Code != http.StatusOK || json.Unmarshal(recorder.Body.Bytes(), &response) != nil {
+			t.Fatalf("вход %s: %d %s", name, recorder.Code, recorder.Body)
+		}
+		return response.Token
+	}
+
+	if recorder := request("POST", "/login", "", `{"login": "Owner", "password": "wrong password"}`); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("неверный пароль: %d", recorder.Code)
+	}
+	ownerToken, otherToken, rootToken := tokenOf("Owner"), tokenOf("Other"), tokenOf("Root")
+
+	postPath := fmt.Sprint("/posts/", post.ID)
+	updateBody := `{"title": "changed", "body": "changed", "version": 1}`
+	for _, tc := range []struct {
+		name, method, path, token, body string
+		want                            int
+	}{
+		{"без токена", "PUT", postPath, "", updateBody, http.StatusUnauthorized},
+		{"чужой токен", "PUT", postPath, "bad token", updateBody, http.StatusUnauthorized},
+		{"PUT чужого поста", "PUT", postPath, otherToken, updateBody, http.StatusForbidden},
+		{"DELETE чужого поста", "DELETE", postPath, otherToken, "", http.StatusForbidden},
+		{"PUT комментария к чужому посту", "PUT", fmt.Sprint("/comments/", post.Comments[0].ID), otherToken, `{"body": "changed"}`, http.StatusForbidden},
+		{"DELETE комментария к чужому посту", "DELETE", fmt.Sprint("/comments/", post.Comments[0].ID), otherToken, "", http.StatusForbidden},
+		{"PUT несуществующего поста", "PUT", "/posts/999", otherToken, updateBody, http.StatusNotFound},
+		{"DELETE несуществующего комментария", "DELETE", "/comments/999", otherToken, "", http.StatusNotFound},
+		{"PUT своего поста", "PUT", postPath, ownerToken, updateBody, http.StatusOK},
+		{"PUT устаревшей версии", "PUT", postPath, ownerToken, updateBody, http.StatusConflict},
+		{"администратор удаляет комментарий", "DELETE", fmt.Sprint("/comments/", post.Comments[1].ID), rootToken, "", http.StatusNoContent},
+	} {
+		if recorder := request(tc.method, tc.path, tc.token, tc.body); recorder.Code != tc.want {
+			t.Errorf("%s: код %d, ожидался %d: %s", tc.name, recorder.Code, tc.want, recorder.Body)
+		}
+	}
+
+	var saved Post
+	db.Preload("Comments").First(&saved, post.ID)
+	if saved.Title != "changed" || saved.Version != 2 || len(saved.Comments) != 1 || saved.Comments[0].Body != "first" {
+		t.Errorf("сохранено %+v", saved)
+	}
+
+	if recorder := request("DELETE", postPath, ownerToken, ""); recorder.Code != http.StatusNoContent {
+		t.Errorf("DELETE своего поста: %d", recorder.Code)
+	}
+	var comments int64
+	db.Model(&Comment{}).Where("post_id = ?", post.ID).Count(&comments)
+	if err := db.First(&Post{}, post.ID).Error; !errors.Is(err, gorm.ErrRecordNotFound) || comments != 0 {
+		t.Errorf("пост не удален: %v, комментариев %d", err, comments)
+	}
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+)
+
+// Кеш результатов запросов. Кешируются только запросы, помеченные Cached:
+//
+//	GetPostCountByUser(db.Scopes(Cached(time.Minute)))
+//
+// Ключ - SQL с плейсхолдерами + параметры + "поколения" таблиц,
+// которые читает запрос (FROM/JOIN). Create/Update/Delete/Exec увеличивают
+// поколение изменяемой таблицы, и старые записи кеша больше не находятся
+// (а затем вытесняются по LRU или TTL).
+//
+// Ограничения: запись внутри транзакции сбрасывает кеш до COMMIT, и параллельный
+// запрос успевает закешировать старые данные - они живут не дольше TTL.
+// Изменения в обход GORM (триггеры, каскадное удаление, другие сервисы)
+// кеш не видит.
+
+const cacheTTLKey = "query_cache:ttl"
+
+// Кешировать результат запроса на ttl
+func Cached(ttl time.Duration) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Set(cacheTTLKey, ttl)
+	}
+}
+
+type CacheBackend interface {
+	Get(ctx context.Context, key string) ([]byte, bool)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration)
+	// Поколение таблицы: меняется при каждой записи в нее
+	Generation(ctx context.Context, table string) int64
+	Bump(ctx context.Context, table string)
+}
+
+type QueryCache struct {
+	Backend CacheBackend
+}
+
+func (QueryCache) Name() string {
+	return "query_cache"
+}
+
+func (c QueryCache) Initialize(db *gorm.DB) error {
+	query := db.Callback().Query().Get("gorm:query")
+	if err := db.Callback().Query().Replace("gorm:query", func(db *gorm.DB) { c.query(db, query) }); err != nil {
+		return err
+	}
+
+	callbacks := db.Callback()
+	for _, err := range []error{
+		callbacks.Create().After("gorm:create").Register("query_cache:create", c.invalidate),
+		callbacks.Update().After("gorm:update").Register("query_cache:update", c.invalidate),
+		callbacks.Delete().After("gorm:delete").Register("query_cache:delete", c.invalidate),
+		callbacks.Raw().After("gorm:raw").Register("query_cache:raw", c.invalidate),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type cachedResult struct {
+	Rows int64
+	Dest json.RawMessage
+}
+
+func (c QueryCache) query(db *gorm.DB, query func(*gorm.DB)) {
+	value, ok := db.Get(cacheTTLKey)
+	ttl, _ := value.(time.Duration)
+	if !ok || ttl <= 0 || db.Error != nil || db.DryRun {
+		query(db)
+		return
+	}
+
+	callbacks.BuildQuerySQL(db)
+	if db.Error != nil {
+		return
+	}
+
+	ctx := db.Statement.Context
+	key := c.key(db)
+
+	if data, ok := c.Backend.Get(ctx, key); ok {
+		var result cachedResult
+		if json.Unmarshal(data, &result) == nil && json.Unmarshal(result.Dest, db.Statement.Dest) == nil {
+			db.RowsAffected = result.Rows
+			return
+		}
+	}
+
+	query(db)
+	if db.Error != nil {
+		return
+	}
+
+	dest, err := json.Marshal(db.Statement.Dest)
+	if err != nil {
+		return
+	}
+	if data, err := json.Marshal(cachedResult{Rows: db.RowsAffected, Dest: dest}); err == nil {
+		c.Backend.Set(ctx, key, data, ttl)
+	}
+}
+
+func (c QueryCache) key(db *gorm.DB) string {
+	sql := db.Statement.SQL.String()
+	vars, _ := json.Marshal(db.Statement.Vars)
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\n%s\n", sql, vars)
+	for _, table := range readTables(sql) {
+		fmt.Fprintf(hash, "%s=%d\n", table, c.Backend.Generation(db.Statement.Context, table))
+	}
+	return "query:" + hex.EncodeToString(hash.Sum(nil))
+}
+
+func (c QueryCache) invalidate(db *gorm.DB) {
+	if db.Error != nil || db.DryRun {
+		return
+	}
+
+	tables := writtenTables(db.Statement.SQL.String())
+	if db.Statement.Table != "" {
+		tables = append(tables, db.Statement.Table)
+	}
+	for _, table := range tables {
+		c.Backend.Bump(db.Statement.Context, table)
+	}
+}
+
+var (
+	readTablePattern  = regexp.MustCompile("(?i)\\b(?:FROM|JOIN)\\s+[\"`]?(\\w+)")
+	writeTablePattern = regexp.MustCompile("(?i)\\b(?:INSERT\\s+INTO|UPDATE|DELETE\\s+FROM|TRUNCATE(?:\\s+TABLE)?)\\s+[\"`]?(\\w+)")
+)
+
+func tableNames(pattern *regexp.Regexp, sql string) []string {
+	seen := map[string]bool{}
+	var tables []string
+	for _, match := range pattern.FindAllStringSubmatch(sql, -1) {
+		table := strings.ToLower(match[1])
+		if !seen[table] {
+			seen[table] = true
+			tables = append(tables, table)
+		}
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+func readTables(sql string) []string {
+	return tableNames(readTablePattern, sql)
+}
+
+func writtenTables(sql string) []string {
+	return tableNames(writeTablePattern, sql)
+}
+
+// In-process LRU: не больше Capacity записей, старые вытесняются
+type LRUCache struct {
+	Capacity int
+
+	mu          sync.Mutex
+	items       map[string]*list.Element
+	order       *list.List // в начале - недавно использованные
+	generations map[string]int64
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+func NewLRUCache(capacity int) *LRUCache {
+	return &LRUCache{
+		Capacity:    capacity,
+		items:       map[string]*list.Element{},
+		order:       list.New(),
+		generations: map[string]int64{},
+	}
+}
+
+func (c *LRUCache) Get(ctx context.Context, key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := element.Value.(*lruEntry)
+	if time.Now().After(entry.expires) {
+		c.order.Remove(element)
+		delete(c.items, key)
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+	return entry.value, true
+}
+
+func (c *LRUCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &lruEntry{key: key, value: value, expires: time.Now().Add(ttl)}
+	if element, ok := c.items[key]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.Capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry).key)
+	}
+}
+
+// Поколения хранятся отдельно от записей и не вытесняются
+func (c *LRUCache) Generation(ctx context.Context, table string) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generations[table]
+}
+
+func (c *LRUCache) Bump(ctx context.Context, table string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generations[table]++
+}
+
+// Внешнее хранилище (Redis, Memcached...): достаточно Get/Set с TTL и Incr
+type KVStore interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Incr(ctx context.Context, key string) (int64, error)
+}
+
+// CacheBackend поверх KVStore. Ошибки хранилища - это промах кеша:
+// запрос просто выполняется в базе.
+type KVBackend struct {
+	Store  KVStore
+	Prefix string // например "jsonplaceholder:"
+}
+
+func (b KVBackend) Get(ctx context.Context, key string) ([]byte, bool) {
+	value, ok, err := b.Store.Get(ctx, b.Prefix+key)
+	return value, ok && err == nil
+}
+
+func (b KVBackend) Set(ctx context.Context, key string, value []byte, ttl time.Duration) {
+	b.Store.Set(ctx, b.Prefix+key, value, ttl)
+}
+
+func (b KVBackend) Generation(ctx context.Context, table string) int64 {
+	value, ok, err := b.Store.Get(ctx, b.Prefix+"generation:"+table)
+	if !ok || err != nil {
+		return 0
+	}
+	generation, _ := strconv.ParseInt(string(value), 10, 64)
+	return generation
+}
+
+func (b KVBackend) Bump(ctx context.Context, table string) {
+	b.Store.Incr(ctx, b.Prefix+"generation:"+table)
+}
+
+// Локальная замена внешнего хранилища (для разработки и проверок)
+type MemoryKV struct {
+	mu    sync.Mutex
+	items map[string]memoryItem
+}
+
+type memoryItem struct {
+	value   []byte
+	expires time.Time // нулевое - без срока
+}
+
+func NewMemoryKV() *MemoryKV {
+	return &MemoryKV{items: map[string]memoryItem{}}
+}
+
+func (s *MemoryKV) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.items[key]
+	if !ok || (!item.expires.IsZero() && time.Now().After(item.expires)) {
+		delete(s.items, key)
+		return nil, false, nil
+	}
+	return item.value, true, nil
+}
+
+func (s *MemoryKV) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item := memoryItem{value: value}
+	if ttl > 0 {
+		item.expires = time.Now().Add(ttl)
+	}
+	s.items[key] = item
+	return nil
+}
+
+func (s *MemoryKV) Incr(ctx context.Context, key string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	value, _ := strconv.ParseInt(string(s.items[key].value), 10, 64)
+	value++
+	s.items[key] = memoryItem{value: []byte(strconv.FormatInt(value, 10))}
+	return value, nil
+}
+
+func exampleQueryCache(db *gorm.DB) {
+	db.Use(QueryCache{Backend: NewLRUCache(1000)})
+	// Внешнее хранилище: db.Use(QueryCache{Backend: KVBackend{Store: NewMemoryKV(), Prefix: "jsonplaceholder:"}})
+
+	// Session - чтобы одну и ту же цепочку можно было использовать много раз
+	cached := db.Scopes(Cached(time.Minute)).Session(&gorm.Session{})
+
+	GetPostCountByUser(cached)       // запрос в базу
+	GetPostCountByUser(cached)       // из кеша
+	GetUserDataWithPostCount(cached) // запрос в базу
+
+	// Новый пост меняет поколение posts - оба отчета снова читаются из базы
+	db.Create(&Post{UserID: 1, Title: "Cache", Body: "invalidation"})
+	GetPostCountByUser(cached)
+	GetUserDataWithPostCount(cached)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Пост в обход GORM: кеш о нем не знает
+func insertPostBypassingCache(t *testing.T, db *gorm.DB, id, userID uint) {
+	t.Helper()
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sqlDB.Exec("INSERT INTO posts (id, user_id, title, version) VALUES (?, ?, 'bypass', 1)", id, userID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func postCount(rows []PostCountByUser, userID uint) int {
+	for _, row := range rows {
+		if row.UserID == userID {
+			return row.PostCount
+		}
+	}
+	return 0
+}
+
+func TestQueryCacheInvalidation(t *testing.T) {
+	backends := map[string]func() CacheBackend{
+		"LRUCache":  func() CacheBackend { return NewLRUCache(100) },
+		"KVBackend": func() CacheBackend { return KVBackend{Store: NewMemoryKV(), Prefix: "test:"} },
+	}
+
+	for name, backend := range backends {
+		t.Run(name, func(t *testing.T) {
+			db := openTestDB(t, &Post{})
+			if err := db.Use(QueryCache{Backend: backend()}); err != nil {
+				t.Fatal(err)
+			}
+			cached := db.Scopes(Cached(time.Minute)).Session(&gorm.Session{})
+
+			db.Create(&Post{UserID: 1, Title: "first"})
+			if got := postCount(GetPostCountByUser(cached), 1); got != 1 {
+				t.Fatalf("постов %d", got)
+			}
+
+			// Второй вызов - из кеша: пост, добавленный в обход GORM, не виден
+			insertPostBypassingCache(t, db, 100, 1)
+			if got := postCount(GetPostCountByUser(cached), 1); got != 1 {
+				t.Fatalf("второй вызов не из кеша: постов %d", got)
+			}
+			// Без Cached запрос идет в базу
+			if got := postCount(GetPostCountByUser(db), 1); got != 2 {
+				t.Fatalf("без кеша постов %d", got)
+			}
+
+			// Create, Update и Delete меняют поколение posts
+			post := Post{UserID: 1, Title: "second"}
+			db.Create(&post)
+			if got := postCount(GetPostCountByUser(cached), 1); got != 3 {
+				t.Errorf("после Create постов %d", got)
+			}
+
+			db.Model(&Post{}).Where("id = ?", post.ID).Update("user_id", 2)
+			rows := GetPostCountByUser(cached)
+			if postCount(rows, 1) != 2 || postCount(rows, 2) != 1 {
+				t.Errorf("после Update %+v", rows)
+			}
+
+			db.Delete(&Post{}, post.ID)
+			rows = GetPostCountByUser(cached)
+			if postCount(rows, 1) != 2 || postCount(rows, 2) != 0 {
+				t.Errorf("после Delete %+v", rows)
+			}
+		})
+	}
+}
+
+func TestQueryCacheTTL(t *testing.T) {
+	db := openTestDB(t, &Post{})
+	if err := db.Use(QueryCache{Backend: NewLRUCache(100)}); err != nil {
+		t.Fatal(err)
+	}
+	cached := db.Scopes(Cached(50 * time.Millisecond)).Session(&gorm.Session{})
+
+	db.Create(&Post{UserID: 1, Title: "first"})
+	GetPostCountByUser(cached)
+	insertPostBypassingCache(t, db, 100, 1)
+	if got := postCount(GetPostCountByUser(cached), 1); got != 1 {
+		t.Fatalf("до истечения TTL постов %d", got)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if got := postCount(GetPostCountByUser(cached), 1); got != 2 {
+		t.Errorf("после истечения TTL постов %d", got)
+	}
+}
+
+func TestQueryCacheNotFound(t *testing.T) {
+	db := openTestDB(t, &Post{})
+	if err := db.Use(QueryCache{Backend: NewLRUCache(100)}); err != nil {
+		t.Fatal(err)
+	}
+	cached := db.Scopes(Cached(time.Minute)).Session(&gorm.Session{})
+
+	var post Post
+	for i := 0; i < 2; i++ {
+		if err := cached.First(&post, 100).Error; !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Fatalf("вызов %d: %v", i+1, err)
+		}
+	}
+
+	// Пустой результат не закеширован - новая строка сразу видна
+	insertPostBypassingCache(t, db, 100, 1)
+	if err := cached.First(&post, 100).Error; err != nil || post.Title != "bypass" {
+		t.Errorf("после вставки: %v %+v", err, post)
+	}
+}
+
+func TestLRUCache(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("TTL", func(t *testing.T) {
+		cache := NewLRUCache(10)
+		cache.Set(ctx, "a", []byte("1"), 20*time.Millisecond)
+		if _, ok := cache.Get(ctx, "a"); !ok {
+			t.Fatal("запись не найдена")
+		}
+		time.Sleep(40 * time.Millisecond)
+		if _, ok := cache.Get(ctx, "a"); ok {
+			t.Error("запись после истечения TTL")
+		}
+	})
+
+	t.Run("вытеснение", func(t *testing.T) {
+		cache := NewLRUCache(2)
+		cache.Set(ctx, "a", []byte("1"), time.Minute)
+		cache.Set(ctx, "b", []byte("2"), time.Minute)
+		cache.Get(ctx, "a") // a использован недавно - вытесняется b
+		cache.Set(ctx, "c", []byte("3"), time.Minute)
+
+		for key, want := range map[string]bool{"a": true, "b": false, "c": true} {
+			if _, ok := cache.Get(ctx, key); ok != want {
+				t.Errorf("%s: в кеше %v, ожидалось %v", key, ok, want)
+			}
+		}
+	})
+
+	t.Run("поколения не вытесняются", func(t *testing.T) {
+		cache := NewLRUCache(1)
+		cache.Bump(ctx, "posts")
+		cache.Set(ctx, "a", []byte("1"), time.Minute)
+		cache.Set(ctx, "b", []byte("2"), time.Minute)
+		if got := cache.Generation(ctx, "posts"); got != 1 {
+			t.Errorf("поколение %d", got)
+		}
+	})
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"gorm.io/gorm"
+)
+
+// Лента изменений: триггеры в базе публикуют событие на каждую
+// вставку, изменение и удаление в posts и comments.
+// Postgres - NOTIFY в канал model_changes и LISTEN на стороне Go.
+// SQLite - триггеры пишут в таблицу model_changes, подписчик ее опрашивает,
+// записи старше changeRetention удаляются.
+// В событии есть tenant_id записи: подписчик с арендатором в контексте
+// (tenancy.go) получает только события своего арендатора.
+
+const changeChannel = "model_changes"
+
+// Сколько хранятся записи model_changes: подписчик, отставший
+// больше чем на это время, пропустит события
+const changeRetention = time.Hour
+
+var changeFeedTables = []string{"posts", "comments"}
+
+type ChangeEvent struct {
+	Table     string `json:"table"`
+	Operation string `json:"operation"` // INSERT, UPDATE, DELETE
+	ID        uint   `json:"id"`
+	TenantID  string `json:"tenant_id"`
+}
+
+// Журнал изменений для опроса (SQLite)
+type ModelChange struct {
+	ID        uint `gorm:"primaryKey"`
+	TableName string
+	Operation string
+	RecordID  uint
+	TenantID  string
+	CreatedAt time.Time `gorm:"index"`
+}
+
+// Установка триггеров (выполняется в autoMigrate, повторный запуск безопасен)
+func installChangeFeed(db *gorm.DB) error {
+	if db.Dialector.Name() == "postgres" {
+		err := db.Exec(`
+			CREATE OR REPLACE FUNCTION notify_model_change() RETURNS trigger AS $$
+			BEGIN
+				PERFORM pg_notify('` + changeChannel + `', json_build_object(
+					'table', TG_TABLE_NAME,
+					'operation', TG_OP,
+					'id', CASE WHEN TG_OP = 'DELETE' THEN OLD.id ELSE NEW.id END,
+					'tenant_id', CASE WHEN TG_OP = 'DELETE' THEN OLD.tenant_id ELSE NEW.tenant_id END
+				)::text);
+				RETURN NULL;
+			END;
+			$$ LANGUAGE plpgsql`).Error
+		if err != nil {
+			return err
+		}
+
+		for _, table := range changeFeedTables {
+			if err := db.Exec(fmt.Sprintf("DROP TRIGGER IF EXISTS %[1]s_notify_change ON %[1]s", table)).Error; err != nil {
+				return err
+			}
+			err := db.Exec(fmt.Sprintf(`
+				CREATE TRIGGER %[1]s_notify_change
+					AFTER INSERT OR UPDATE OR DELETE ON %[1]s
+					FOR EACH ROW EXECUTE FUNCTION notify_model_change()`, table)).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := db.AutoMigrate(&ModelChange{}); err != nil {
+		return err
+	}
+
+	for _, table := range changeFeedTables {
+		for _, op := range []struct{ name, row string }{
+			{"INSERT", "NEW"},
+			{"UPDATE", "NEW"},
+			{"DELETE", "OLD"},
+		} {
+			// Пересоздаем: триггер прошлой версии мог писать не все столбцы
+			if err := db.Exec(fmt.Sprintf("DROP TRIGGER IF EXISTS %s_%s_change", table, op.name)).Error; err != nil {
+				return err
+			}
+			err := db.Exec(fmt.Sprintf(`
+				CREATE TRIGGER %[1]s_%[2]s_change AFTER %[2]s ON %[1]s
+				BEGIN
+					INSERT INTO model_changes (table_name, operation, record_id, tenant_id, created_at)
+					VALUES ('%[1]s', '%[2]s', %[3]s.id, %[3]s.tenant_id, CURRENT_TIMESTAMP);
+				END`, table, op.name, op.row)).Error
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Подписка на изменения. Канал закрывается при отмене ctx.
+// dsn нужен для отдельного соединения под LISTEN (только Postgres).
+// С арендатором в ctx (WithTenant) приходят только его события.
+func SubscribeChanges(ctx context.Context, db *gorm.DB, dsn string) <-chan ChangeEvent {
+	events := make(chan ChangeEvent, 100)
+
+	if db.Dialector.Name() == "postgres" {
+		go listenChanges(ctx, dsn, events)
+	} else {
+		// События, записанные до подписки, пропускаются
+		var lastID uint
+		db.WithContext(WithoutTenant(ctx)).Model(&ModelChange{}).Select("COALESCE(MAX(id), 0)").Scan(&lastID)
+		go pollChanges(ctx, db, time.Second, lastID, events)
+	}
+
+	return events
+}
+
+// LISTEN с переподключением: при обрыве соединения ждем и подключаемся снова,
+// пауза растет от 1 до 30 секунд
+func listenChanges(ctx context.Context, dsn string, events chan<- ChangeEvent) {
+	defer close(events)
+
+	backoff := time.Second
+	for ctx.Err() == nil {
+		err := listenOnce(ctx, dsn, events, func() { backoff = time.Second })
+		if ctx.Err() != nil {
+			return
+		}
+
+		fmt.Println("Соединение LISTEN потеряно:", err, "- повтор через", backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, 30*time.Second)
+	}
+}
+
+func listenOnce(ctx context.Context, dsn string, events chan<- ChangeEvent, connected func()) error {
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+changeChannel); err != nil {
+		return err
+	}
+	connected()
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var event ChangeEvent
+		if err := json.Unmarshal([]byte(notification.Payload), &event); err != nil {
+			fmt.Println("Некорректное событие:", notification.Payload)
+			continue
+		}
+		if !changeVisible(ctx, event) {
+			continue
+		}
+
+		select {
+		case events <- event:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Событие арендатора из ctx; без арендатора и с WithoutTenant - любое
+func changeVisible(ctx context.Context, event ChangeEvent) bool {
+	if bypass, _ := ctx.Value(tenantBypassKey{}).(bool); bypass {
+		return true
+	}
+	tenant, ok := TenantFromContext(ctx)
+	return !ok || event.TenantID == tenant
+}
+
+// Удаление записей model_changes старше retention (время - по часам SQLite,
+// как CURRENT_TIMESTAMP в триггерах)
+func pruneModelChanges(db *gorm.DB, retention time.Duration) error {
+	return db.Where("created_at < datetime('now', ?)", fmt.Sprintf("-%d seconds", int(retention.Seconds()))).
+		Delete(&ModelChange{}).Error
+}
+
+// Опрос журнала model_changes: события с id больше последнего прочитанного
+func pollChanges(ctx context.Context, db *gorm.DB, interval time.Duration, lastID uint, events chan<- ChangeEvent) {
+	defer close(events)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// Журнал общий для всех арендаторов: читаем без фильтра плагина,
+	// события отбирает changeVisible
+	journal := db.WithContext(WithoutTenant(ctx))
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		pruneModelChanges(journal, changeRetention)
+
+		var changes []ModelChange
+		if err := journal.Where("id > ?", lastID).Order("id").Find(&changes).Error; err != nil {
+			continue
+		}
+
+		for _, change := range changes {
+			lastID = change.ID
+			event := ChangeEvent{Table: change.TableName, Operation: change.Operation, ID: change.RecordID, TenantID: change.TenantID}
+			if !changeVisible(ctx, event) {
+				continue
+			}
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// Типизированное событие: запись модели T, загруженная по ID
+// (для DELETE и уже удаленных записей заполнен только ID)
+type ModelEvent[T any] struct {
+	Operation string
+	ID        uint
+	Record    T
+}
+
+// События одной таблицы (по модели T) с загрузкой записи.
+// Ошибка - если T не модель GORM.
+func ModelEvents[T any](ctx context.Context, db *gorm.DB, events <-chan ChangeEvent) (<-chan ModelEvent[T], error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(new(T)); err != nil {
+		return nil, err
+	}
+	table := stmt.Schema.Table
+
+	result := make(chan ModelEvent[T])
+
+	go func() {
+		defer close(result)
+
+		for event := range events {
+			if event.Table != table {
+				continue
+			}
+
+			// Запись могла быть уже удалена - тогда событие приходит без нее
+			modelEvent := ModelEvent[T]{Operation: event.Operation, ID: event.ID}
+			if event.Operation != "DELETE" {
+				db.WithContext(ctx).Limit(1).Find(&modelEvent.Record, event.ID)
+			}
+
+			select {
+			case result <- modelEvent:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return result, nil
+}
+
+// Триггеры устанавливает autoMigrate
+func exampleChangeFeed(db *gorm.DB, dsn string) {
+	ctx := db.Statement.Context // арендатор из main
+	postEvents, err := ModelEvents[Post](ctx, db, SubscribeChanges(ctx, db, dsn))
+	if err != nil {
+		fmt.Println("Ошибка:", err)
+		return
+	}
+	for event := range postEvents {
+		fmt.Printf("%s post.id: %d\n", event.Operation, event.ID)
+		fmt.Printf("post.title: %s\n", event.Record.Title)
+		fmt.Println("-------------")
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestChangeFeedSQLite(t *testing.T) {
+	db := openTestDB(t, &Post{}, &Comment{})
+	if err := installChangeFeed(db); err != nil {
+		t.Fatal(err)
+	}
+	// Повторная установка (autoMigrate при каждом запуске)
+	if err := installChangeFeed(db); err != nil {
+		t.Fatal(err)
+	}
+
+	// Изменения до подписки в ленту не попадают
+	db.Create(&Post{UserID: 1, Title: "before"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	events, err := ModelEvents[Post](ctx, db, SubscribeChanges(ctx, db, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next := func(operation, title string) ModelEvent[Post] {
+		t.Helper()
+		select {
+		case event := <-events:
+			if event.Operation != operation || event.Record.Title != title {
+				t.Errorf("событие %+v, ожидалось %s %q", event, operation, title)
+			}
+			return event
+		case <-ctx.Done():
+			t.Fatalf("нет события %s", operation)
+			return ModelEvent[Post]{}
+		}
+	}
+
+	post := Post{UserID: 1, Title: "created"}
+	db.Create(&post)
+	db.Create(&Comment{PostID: post.ID, Body: "comment"}) // другая таблица
+	if event := next("INSERT", "created"); event.ID != post.ID {
+		t.Errorf("INSERT id %d, ожидался %d", event.ID, post.ID)
+	}
+
+	db.Model(&Post{}).Where("id = ?", post.ID).Update("title", "updated")
+	next("UPDATE", "updated")
+
+	// Для удаленной записи - только ID
+	db.Delete(&Post{}, post.ID)
+	if event := next("DELETE", ""); event.ID != post.ID {
+		t.Errorf("DELETE id %d, ожидался %d", event.ID, post.ID)
+	}
+}
+
+func TestModelEventsNotModel(t *testing.T) {
+	db := openTestDB(t)
+	if _, err := ModelEvents[int](context.Background(), db, nil); err == nil {
+		t.Error("ModelEvents[int] без ошибки")
+	}
+}
+
+func TestChangeFeedTenant(t *testing.T) {
+	db := openTestDB(t, &Post{}, &Comment{})
+	if err := installChangeFeed(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Use(TenantPlugin{}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(WithTenant(context.Background(), "team_a"), 10*time.Second)
+	defer cancel()
+	events := SubscribeChanges(ctx, db, "")
+
+	teamB := db.WithContext(WithTenant(context.Background(), "team_b"))
+	teamB.Create(&Post{UserID: 1, Title: "team_b"})
+	post := Post{UserID: 1, Title: "team_a"}
+	db.WithContext(ctx).Create(&post)
+
+	// Событие team_b пропущено, первое - пост team_a
+	select {
+	case event := <-events:
+		if event.ID != post.ID || event.TenantID != "team_a" || event.Operation != "INSERT" {
+			t.Errorf("событие %+v, ожидался INSERT поста %d team_a", event, post.ID)
+		}
+	case <-ctx.Done():
+		t.Fatal("нет события team_a")
+	}
+}
+
+func TestPruneModelChanges(t *testing.T) {
+	db := openTestDB(t, &Post{}, &Comment{})
+	if err := installChangeFeed(db); err != nil {
+		t.Fatal(err)
+	}
+
+	db.Create(&Post{UserID: 1, Title: "old"})
+	db.Model(&ModelChange{}).Where("1 = 1").Update("created_at", gorm.Expr("datetime('now', '-2 hours')"))
+	db.Create(&Post{UserID: 1, Title: "new"})
+
+	if err := pruneModelChanges(db, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	var changes []ModelChange
+	db.Find(&changes)
+	if len(changes) != 1 || changes[0].RecordID != 2 {
+		t.Errorf("осталось %+v", changes)
+	}
+}
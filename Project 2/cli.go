@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+// Команды: go run . <команда> [флаги]
+var commands = map[string]func(db *gorm.DB, args []string) error{
+	"export":      exportCommand,
+	"import":      importCommand,
+	"rls":         rlsCommand,
+	"passwd":      passwdCommand,
+	"gen":         genCommand,
+	"schema":      schemaCommand,
+	"constraints": constraintsCommand,
+	"advise":      adviseCommand,
+	"explain":     explainCommand,
+}
+
+// Команды без базы: выполняются до подключения к ней
+var offlineCommands = map[string]func(args []string) error{
+	"openapi": openAPICommand,
+}
+
+// Выполняет команду без базы, false - это не такая команда
+func runOfflineCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+
+	command, ok := offlineCommands[args[0]]
+	if !ok {
+		return false
+	}
+
+	exitOnError(command(args[1:]))
+	return true
+}
+
+// Выполняет команду из аргументов, false - команда не указана
+func runCommand(db *gorm.DB, args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+
+	command, ok := commands[args[0]]
+	if !ok {
+		names := make([]string, 0, len(commands)+len(offlineCommands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		for name := range offlineCommands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		fmt.Println("Неизвестная команда:", args[0])
+		fmt.Println("Доступные команды:", names)
+		os.Exit(2)
+	}
+
+	exitOnError(command(db, args[1:]))
+	return true
+}
+
+func exitOnError(err error) {
+	if err != nil {
+		fmt.Println("Ошибка:", err)
+		os.Exit(1)
+	}
+}
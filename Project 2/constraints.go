@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Индексы и ограничения объявлены в тегах моделей (main.go): на новой базе
+// их создает autoMigrate. Для существующей базы:
+//
+//	go run . constraints migrate
+//
+// Сначала проверяются данные: дубликаты email, посты и комментарии без
+// владельца и т.п. - иначе ограничение не создать, и вместо ошибки базы
+// выводится, что именно надо исправить. Затем в одной транзакции
+// внешние ключи пересоздаются с ON DELETE CASCADE (AutoMigrate не меняет
+// существующие), а AutoMigrate добавляет индексы, NOT NULL и CHECK.
+
+type constraintCheck struct {
+	problem string
+	query   string // число строк, нарушающих ограничение
+}
+
+var constraintChecks = []constraintCheck{
+	{"повторяющиеся email у пользователей",
+		"SELECT COUNT(*) FROM (SELECT tenant_id, email FROM users GROUP BY tenant_id, email HAVING COUNT(*) > 1) d"},
+	{"пользователи без email или с email без @",
+		"SELECT COUNT(*) FROM users WHERE email IS NULL OR email NOT LIKE '%@%'"},
+	{"несколько адресов у пользователя",
+		"SELECT COUNT(*) FROM (SELECT user_id FROM user_addresses GROUP BY user_id HAVING COUNT(*) > 1) d"},
+	{"несколько компаний у пользователя",
+		"SELECT COUNT(*) FROM (SELECT user_id FROM user_companies GROUP BY user_id HAVING COUNT(*) > 1) d"},
+	{"адреса несуществующих пользователей",
+		"SELECT COUNT(*) FROM user_addresses WHERE user_id IS NULL OR user_id NOT IN (SELECT id FROM users)"},
+	{"компании несуществующих пользователей",
+		"SELECT COUNT(*) FROM user_companies WHERE user_id IS NULL OR user_id NOT IN (SELECT id FROM users)"},
+	{"посты несуществующих пользователей",
+		"SELECT COUNT(*) FROM posts WHERE user_id IS NULL OR user_id NOT IN (SELECT id FROM users)"},
+	{"посты без заголовка",
+		"SELECT COUNT(*) FROM posts WHERE title IS NULL OR title = ''"},
+	{"комментарии к несуществующим постам",
+		"SELECT COUNT(*) FROM comments WHERE post_id IS NULL OR post_id NOT IN (SELECT id FROM posts)"},
+}
+
+// Внешние ключи: модель и связь, по которой GORM строит ограничение
+var foreignKeyConstraints = []struct {
+	model    interface{}
+	relation string
+}{
+	{&User{}, "Address"},
+	{&User{}, "Company"},
+	{&User{}, "Posts"},
+	{&Post{}, "Comments"},
+}
+
+func constraintsCommand(db *gorm.DB, args []string) error {
+	if len(args) == 0 || args[0] != "migrate" {
+		return errors.New("использование: constraints migrate")
+	}
+	if err := migrateConstraints(db); err != nil {
+		return err
+	}
+	fmt.Println("Индексы и ограничения созданы.")
+	return nil
+}
+
+// Проблемы в данных, из-за которых ограничения не создать
+func checkConstraintData(db *gorm.DB) ([]string, error) {
+	var problems []string
+	for _, check := range constraintChecks {
+		var count int64
+		if err := db.Raw(check.query).Scan(&count).Error; err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			problems = append(problems, fmt.Sprintf("%s: %d", check.problem, count))
+		}
+	}
+	return problems, nil
+}
+
+func migrateConstraints(db *gorm.DB) error {
+	problems, err := checkConstraintData(db)
+	if err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("сначала исправьте данные:\n  %s", strings.Join(problems, "\n  "))
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		migrator := tx.Migrator()
+		for _, fk := range foreignKeyConstraints {
+			if migrator.HasConstraint(fk.model, fk.relation) {
+				if err := migrator.DropConstraint(fk.model, fk.relation); err != nil {
+					return err
+				}
+			}
+			if err := migrator.CreateConstraint(fk.model, fk.relation); err != nil {
+				return fmt.Errorf("внешний ключ %s: %w", fk.relation, err)
+			}
+		}
+
+		// После внешних ключей: SQLite пересоздает таблицу ради ограничения
+		// и теряет ее индексы, AutoMigrate создаст их заново
+		return tx.AutoMigrate(&User{}, &UserAddress{}, &UserCompany{}, &Post{}, &Comment{})
+	})
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// План выполнения функции-запроса из main.go (список - queryHelpers в advisor.go):
+//
+//	go run . explain FindTop3PostsPerUser
+//	go run . explain                      // список функций
+//
+// SQL захватывается в режиме DryRun, затем выполняется
+// EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON) - запрос выполняется по-настоящему,
+// внутри транзакции, которая потом откатывается. План выводится деревом:
+// оценка и факт по строкам, время и буферы каждого узла. Горячие точки -
+// узлы, на которые приходится больше всего собственного времени
+// (без дочерних узлов), и узлы, где оценка строк сильно расходится с фактом.
+//
+// В SQLite - только EXPLAIN QUERY PLAN, без стоимости и времени.
+
+// Доля собственного времени узла, с которой он считается горячей точкой
+const hotSpotShare = 0.2
+
+// Во сколько раз оценка строк может отличаться от факта без предупреждения
+const misestimateFactor = 10
+
+// Результат EXPLAIN ANALYZE одного запроса
+type ExplainResult struct {
+	Plan          PlanNode `json:"Plan"`
+	PlanningTime  float64  `json:"Planning Time"`
+	ExecutionTime float64  `json:"Execution Time"`
+}
+
+func explainCommand(db *gorm.DB, args []string) error {
+	if len(args) == 0 {
+		fmt.Println("использование: explain <функция>")
+		for _, helper := range queryHelpers {
+			fmt.Println("  " + helper.name)
+		}
+		return nil
+	}
+
+	run, err := findQueryHelper(args[0])
+	if err != nil {
+		return err
+	}
+	queries, err := captureQueries(db, run)
+	if err != nil {
+		return err
+	}
+	if len(queries) == 0 {
+		return fmt.Errorf("%s не выполнила ни одного запроса", args[0])
+	}
+
+	for i, query := range queries {
+		fmt.Printf("%s, запрос %d из %d:\n%s\n\n", args[0], i+1, len(queries), strings.TrimSpace(query.SQL))
+		if warning := query.preloadWarning(); warning != "" {
+			fmt.Printf("%s\n\n", warning)
+		}
+
+		if db.Dialector.Name() != "postgres" {
+			if err := explainQueryPlan(db, query, os.Stdout); err != nil {
+				return err
+			}
+			continue
+		}
+
+		result, err := explainAnalyze(db, query)
+		if err != nil {
+			return err
+		}
+		renderPlan(os.Stdout, result)
+	}
+	return nil
+}
+
+func explainAnalyze(db *gorm.DB, query CapturedQuery) (ExplainResult, error) {
+	var result ExplainResult
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return result, err
+	}
+	// ANALYZE выполняет запрос - откатываем, даже если это не SELECT
+	tx, err := sqlDB.Begin()
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+
+	var plan []byte
+	if err := tx.QueryRow("EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON) "+query.SQL, query.Vars...).Scan(&plan); err != nil {
+		return result, err
+	}
+
+	var results []ExplainResult
+	if err := json.Unmarshal(plan, &results); err != nil {
+		return result, err
+	}
+	if len(results) == 0 {
+		return result, errors.New("пустой план")
+	}
+	return results[0], nil
+}
+
+// Собственное время узла: общее (за все повторы) минус время дочерних
+func (n PlanNode) selfTime() float64 {
+	self := n.ActualTotalTime * n.ActualLoops
+	for _, child := range n.Plans {
+		self -= child.ActualTotalTime * child.ActualLoops
+	}
+	return max(self, 0)
+}
+
+func (n PlanNode) title() string {
+	// Как в текстовом EXPLAIN: Hash Left Join, Nested Loop Left Join
+	title := n.NodeType
+	if n.JoinType != "" && n.JoinType != "Inner" {
+		if name, ok := strings.CutSuffix(title, " Join"); ok {
+			title = name + " " + n.JoinType + " Join"
+		} else {
+			title += " " + n.JoinType + " Join"
+		}
+	}
+	if n.IndexName != "" {
+		title += " using " + n.IndexName
+	}
+	if n.RelationName != "" {
+		title += " on " + n.RelationName
+		if n.Alias != "" && n.Alias != n.RelationName {
+			title += " " + n.Alias
+		}
+	}
+	return title
+}
+
+type hotSpot struct {
+	node  PlanNode
+	share float64
+}
+
+func renderPlan(w io.Writer, result ExplainResult) {
+	total := result.Plan.ActualTotalTime * max(result.Plan.ActualLoops, 1)
+
+	var hotSpots []hotSpot
+	var render func(node PlanNode, depth int)
+	render = func(node PlanNode, depth int) {
+		indent := strings.Repeat("  ", depth)
+		prefix := ""
+		if depth > 0 {
+			prefix = "-> "
+		}
+
+		share := 0.0
+		if total > 0 {
+			share = node.selfTime() / total
+		}
+		marker := ""
+		if share >= hotSpotShare {
+			marker = fmt.Sprintf("  <-- %.0f%% времени", share*100)
+			hotSpots = append(hotSpots, hotSpot{node, share})
+		}
+
+		fmt.Fprintf(w, "%s%s%s  (стоимость %.2f..%.2f, строк %.0f / факт %.0f x %.0f, %.3f мс)%s\n",
+			indent, prefix, node.title(), node.StartupCost, node.TotalCost,
+			node.PlanRows, node.ActualRows, node.ActualLoops, node.ActualTotalTime, marker)
+
+		details := indent + strings.Repeat(" ", len(prefix)) + "   "
+		for _, detail := range []struct{ name, value string }{
+			{"Index Cond", node.IndexCond},
+			{"Hash Cond", node.HashCond},
+			{"Merge Cond", node.MergeCond},
+			{"Join Filter", node.JoinFilter},
+			{"Filter", node.Filter},
+			{"Sort Key", strings.Join(node.SortKey, ", ")},
+		} {
+			if detail.value != "" {
+				fmt.Fprintf(w, "%s%s: %s\n", details, detail.name, detail.value)
+			}
+		}
+		if node.RowsRemovedByFilter > 0 {
+			fmt.Fprintf(w, "%sотброшено фильтром: %.0f\n", details, node.RowsRemovedByFilter)
+		}
+		if node.SharedHitBlocks+node.SharedReadBlocks > 0 {
+			fmt.Fprintf(w, "%sбуферы: в кеше %d, прочитано %d\n", details, node.SharedHitBlocks, node.SharedReadBlocks)
+		}
+		if node.ActualLoops == 0 {
+			fmt.Fprintf(w, "%sне выполнялся\n", details)
+		} else if estimate, actual := max(node.PlanRows, 1), max(node.ActualRows, 1); estimate/actual >= misestimateFactor || actual/estimate >= misestimateFactor {
+			fmt.Fprintf(w, "%sоценка строк расходится с фактом в %.0f раз - обновите статистику (ANALYZE)\n",
+				details, max(estimate/actual, actual/estimate))
+		}
+
+		for _, child := range node.Plans {
+			render(child, depth+1)
+		}
+	}
+	render(result.Plan, 0)
+
+	fmt.Fprintf(w, "\nпланирование %.3f мс, выполнение %.3f мс\n", result.PlanningTime, result.ExecutionTime)
+
+	if len(hotSpots) > 0 {
+		sort.Slice(hotSpots, func(i, j int) bool {
+			return hotSpots[i].share > hotSpots[j].share
+		})
+		fmt.Fprintln(w, "горячие точки:")
+		for _, spot := range hotSpots {
+			fmt.Fprintf(w, "  %.0f%%  %s", spot.share*100, spot.node.title())
+			if spot.node.NodeType == "Seq Scan" && spot.node.Filter != "" {
+				fmt.Fprint(w, " - возможно, нужен индекс по условию фильтра")
+			}
+			fmt.Fprintln(w)
+		}
+	}
+	fmt.Fprintln(w)
+}
+
+// SQLite: дерево из EXPLAIN QUERY PLAN (id, parent, detail)
+func explainQueryPlan(db *gorm.DB, query CapturedQuery, w io.Writer) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	rows, err := sqlDB.Query("EXPLAIN QUERY PLAN "+query.SQL, query.Vars...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	depth := map[int]int{}
+	for rows.Next() {
+		var id, parent, notUsed int
+		var detail sql.NullString
+		if err := rows.Scan(&id, &parent, &notUsed, &detail); err != nil {
+			return err
+		}
+		depth[id] = depth[parent] + 1
+		fmt.Fprintf(w, "%s-> %s\n", strings.Repeat("  ", depth[id]-1), detail.String)
+	}
+	fmt.Fprintln(w)
+	return rows.Err()
+}
@@ -0,0 +1,500 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jinzhu/inflection"
+	"gorm.io/gorm"
+)
+
+// Генератор моделей по существующей базе (introspect.go):
+//
+//	go run . gen models -dir=models
+//	go run . gen models -dsn="host=localhost user=postgres password=root dbname=golang port=5432 sslmode=disable" -tables=my_models
+//	go run . gen models -dsn=legacy.db -dry-run
+//
+// Для каждой таблицы - файл <таблица>_gen.go со структурой, тегами gorm
+// (column, primaryKey, size, not null, default, index/uniqueIndex)
+// и связями по внешним ключам. Файлы *_gen.go перезаписываются при каждом
+// запуске, поэтому свои методы надо писать в других файлах пакета.
+// Файл без заголовка генератора не перезаписывается никогда.
+
+const genHeader = "// Code generated by gen models; DO NOT EDIT."
+
+func genCommand(db *gorm.DB, args []string) error {
+	if len(args) == 0 || args[0] != "models" {
+		return errors.New("использование: gen models [-dsn=...] [-dir=models] [-package=...] [-tables=a,b] [-dry-run]")
+	}
+
+	flags := flag.NewFlagSet("gen models", flag.ExitOnError)
+	dsn := flags.String("dsn", "", "другая база: Postgres или файл SQLite, как DATABASE_DSN (по умолчанию - база приложения)")
+	dir := flags.String("dir", "models", "каталог для файлов")
+	pkg := flags.String("package", "", "имя пакета (по умолчанию - имя каталога)")
+	tableList := flags.String("tables", "", "таблицы через запятую (по умолчанию - все)")
+	dryRun := flags.Bool("dry-run", false, "вывести код, не записывая файлы")
+	flags.Parse(args[1:])
+
+	if *dsn != "" {
+		var err error
+		db, err = gorm.Open(openDialector(*dsn), &gorm.Config{})
+		if err != nil {
+			return err
+		}
+		if sqlDB, err := db.DB(); err == nil {
+			defer sqlDB.Close()
+		}
+	}
+
+	var tables []string
+	for _, table := range strings.Split(*tableList, ",") {
+		if table = strings.TrimSpace(table); table != "" {
+			tables = append(tables, table)
+		}
+	}
+
+	infos, err := introspectDatabase(db, tables)
+	if err != nil {
+		return err
+	}
+	if len(infos) == 0 {
+		return errors.New("таблицы не найдены")
+	}
+
+	if *pkg == "" {
+		*pkg = packageName(*dir)
+	}
+	files, err := generateModels(db, infos, *pkg)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if *dryRun {
+		for _, name := range names {
+			fmt.Printf("// %s\n%s\n", name, files[name])
+		}
+		return nil
+	}
+
+	// Сначала проверяем все файлы: либо записываем все, либо ничего
+	for _, name := range names {
+		if err := checkGenerated(filepath.Join(*dir, name)); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		return err
+	}
+	for _, name := range names {
+		path := filepath.Join(*dir, name)
+		if err := os.WriteFile(path, files[name], 0o644); err != nil {
+			return err
+		}
+		fmt.Println("Записан", path)
+	}
+	return nil
+}
+
+// Существующий файл можно перезаписать, только если его создал генератор
+func checkGenerated(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(data, []byte(genHeader)) {
+		return fmt.Errorf("%s написан вручную (нет заголовка генератора), не перезаписываю", path)
+	}
+	return nil
+}
+
+var nonIdentifier = regexp.MustCompile(`[^a-z0-9_]`)
+
+func packageName(dir string) string {
+	name := nonIdentifier.ReplaceAllString(strings.ToLower(filepath.Base(dir)), "")
+	if name == "" || name == "." || (name[0] >= '0' && name[0] <= '9') {
+		return "models"
+	}
+	return name
+}
+
+type genModel struct {
+	table       TableInfo
+	name        string
+	embedModel  bool              // id, created_at, updated_at, deleted_at -> gorm.Model
+	fieldNames  map[string]string // столбец -> поле
+	uintColumns map[string]bool
+	fields      []genField
+	relations   []genField
+	used        map[string]bool
+	imports     map[string]bool
+}
+
+type genField struct {
+	name, typ, tag, comment string
+}
+
+func generateModels(db *gorm.DB, tables []TableInfo, pkg string) (map[string][]byte, error) {
+	models := map[string]*genModel{}
+	structNames := map[string]string{}
+	for _, table := range tables {
+		name := goName(inflection.Singular(table.Name))
+		// users и user в одной базе - не одна и та же структура
+		if other, ok := structNames[name]; ok {
+			return nil, fmt.Errorf("таблицы %s и %s дают одну структуру %s", other, table.Name, name)
+		}
+		structNames[name] = table.Name
+		models[table.Name] = &genModel{
+			table:       table,
+			name:        name,
+			fieldNames:  map[string]string{},
+			uintColumns: map[string]bool{},
+			used:        map[string]bool{},
+			imports:     map[string]bool{},
+		}
+	}
+
+	// Целочисленные первичные ключи - uint, как в моделях GORM,
+	// и внешние ключи на них - тоже uint
+	for _, model := range models {
+		for _, column := range model.table.Columns {
+			if _, ok := intType(column.Type); ok && column.PrimaryKey {
+				model.uintColumns[column.Name] = true
+			}
+		}
+	}
+	for _, model := range models {
+		for _, fk := range model.table.ForeignKeys {
+			if ref, ok := models[fk.RefTable]; ok && ref.uintColumns[fk.RefColumn] {
+				if column, ok := model.table.Column(fk.Column); ok {
+					if _, ok := intType(column.Type); ok {
+						model.uintColumns[fk.Column] = true
+					}
+				}
+			}
+		}
+	}
+
+	for _, model := range models {
+		model.addColumns()
+	}
+	for _, table := range tables {
+		addRelations(models, models[table.Name])
+	}
+
+	files := map[string][]byte{}
+	for _, table := range tables {
+		source, err := models[table.Name].render(db, pkg)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", table.Name, err)
+		}
+		files[table.Name+"_gen.go"] = source
+	}
+	return files, nil
+}
+
+func (m *genModel) addColumns() {
+	id, hasID := m.table.Column("id")
+	_, hasCreated := m.table.Column("created_at")
+	_, hasUpdated := m.table.Column("updated_at")
+	_, hasDeleted := m.table.Column("deleted_at")
+	m.embedModel = hasID && id.PrimaryKey && m.uintColumns["id"] && hasCreated && hasUpdated && hasDeleted
+
+	if m.embedModel {
+		m.imports["gorm.io/gorm"] = true
+		for column, field := range map[string]string{"id": "ID", "created_at": "CreatedAt", "updated_at": "UpdatedAt", "deleted_at": "DeletedAt"} {
+			m.fieldNames[column] = field
+			m.used[field] = true
+		}
+	}
+
+	indexTags := m.indexTags()
+	for _, column := range m.table.Columns {
+		if _, ok := m.fieldNames[column.Name]; ok {
+			continue
+		}
+
+		name := m.unique(goName(column.Name))
+		m.fieldNames[column.Name] = name
+
+		typ, comment := m.columnType(column)
+		tags := []string{"column:" + column.Name}
+		if column.PrimaryKey {
+			tags = append(tags, "primaryKey")
+			if column.AutoIncrement {
+				tags = append(tags, "autoIncrement")
+			}
+		}
+		if column.Type == "json" || column.Type == "jsonb" || column.Type == "uuid" {
+			tags = append(tags, "type:"+column.Type)
+		}
+		if column.Length > 0 {
+			tags = append(tags, fmt.Sprintf("size:%d", column.Length))
+		}
+		if !column.Nullable && !column.PrimaryKey {
+			tags = append(tags, "not null")
+		}
+		if value := defaultValue(column); value != "" {
+			tags = append(tags, "default:"+value)
+		}
+		tags = append(tags, indexTags[column.Name]...)
+
+		m.fields = append(m.fields, genField{
+			name:    name,
+			typ:     typ,
+			tag:     fmt.Sprintf("gorm:%q", strings.Join(tags, ";")),
+			comment: comment,
+		})
+	}
+}
+
+// Теги index/uniqueIndex по столбцам; у составных индексов - priority
+func (m *genModel) indexTags() map[string][]string {
+	tags := map[string][]string{}
+	for _, index := range m.table.Indexes {
+		if index.PrimaryKey {
+			continue
+		}
+		kind := "index"
+		if index.Unique {
+			kind = "uniqueIndex"
+		}
+		for i, column := range index.Columns {
+			tag := kind + ":" + index.Name
+			if len(index.Columns) > 1 {
+				tag += fmt.Sprintf(",priority:%d", i+1)
+			}
+			tags[column] = append(tags[column], tag)
+		}
+	}
+	return tags
+}
+
+// Тип поля и комментарий, если тип не распознан
+func (m *genModel) columnType(column ColumnInfo) (string, string) {
+	if column.Name == "deleted_at" {
+		m.imports["gorm.io/gorm"] = true
+		return "gorm.DeletedAt", ""
+	}
+
+	typ, comment := "", ""
+	if t, ok := intType(column.Type); ok {
+		typ = t
+		if m.uintColumns[column.Name] {
+			typ = "uint"
+		}
+	} else {
+		switch column.Type {
+		case "bool", "boolean":
+			typ = "bool"
+		case "float4", "real":
+			typ = "float32"
+		case "float8", "double precision", "double", "float", "numeric", "decimal":
+			typ = "float64"
+		case "timestamp", "timestamptz", "timestamp with time zone", "timestamp without time zone",
+			"date", "datetime", "time", "timetz":
+			m.imports["time"] = true
+			typ = "time.Time"
+		case "bytea", "blob":
+			typ = "[]byte"
+		case "json", "jsonb":
+			m.imports["encoding/json"] = true
+			typ = "json.RawMessage"
+		default:
+			typ = "string"
+			if !isTextType(column.Type) && column.Type != "uuid" && column.Type != "citext" {
+				comment = "// тип в базе: " + column.Type
+			}
+		}
+	}
+
+	// NULL - указатель; у срезов NULL и так nil
+	if column.Nullable && !column.PrimaryKey && !strings.HasPrefix(typ, "[]") && typ != "json.RawMessage" {
+		typ = "*" + typ
+	}
+	return typ, comment
+}
+
+func intType(typ string) (string, bool) {
+	switch typ {
+	case "int2", "smallint", "smallserial":
+		return "int16", true
+	case "int4", "int", "serial", "mediumint":
+		return "int32", true
+	case "int8", "bigint", "bigserial", "integer":
+		// integer в SQLite - 64 бита
+		return "int64", true
+	}
+	return "", false
+}
+
+var defaultCast = regexp.MustCompile(`::[a-z ]+(\[\])?$`)
+
+// Значение по умолчанию для тега: без приведения типа ('user'::character varying),
+// последовательности (nextval) не переносим - это autoIncrement
+func defaultValue(column ColumnInfo) string {
+	value := strings.TrimSpace(column.Default)
+	if value == "" || strings.HasPrefix(value, "nextval(") || strings.EqualFold(value, "null") {
+		return ""
+	}
+	value = defaultCast.ReplaceAllString(value, "")
+	return strings.ReplaceAll(value, ";", `\;`)
+}
+
+// Связи по внешним ключам: belongs to у таблицы со ссылкой,
+// has many (has one - при уникальном столбце) у таблицы, на которую ссылаются.
+// Только между генерируемыми таблицами.
+func addRelations(models map[string]*genModel, model *genModel) {
+	refCount := map[string]int{}
+	for _, fk := range model.table.ForeignKeys {
+		refCount[fk.RefTable]++
+	}
+
+	for _, fk := range model.table.ForeignKeys {
+		ref, ok := models[fk.RefTable]
+		if !ok {
+			continue
+		}
+		foreignKey := model.fieldNames[fk.Column]
+		references := ref.fieldNames[fk.RefColumn]
+		if foreignKey == "" || references == "" {
+			continue
+		}
+		tag := fmt.Sprintf("gorm:\"foreignKey:%s;references:%s\"", foreignKey, references)
+
+		// user_id -> User, author_id -> Author
+		prefix := goName(strings.TrimSuffix(fk.Column, "_id"))
+		if prefix == goName(fk.Column) {
+			prefix = ref.name
+		}
+		belongsTo := prefix
+		if model.used[belongsTo] {
+			belongsTo = prefix + ref.name
+		}
+		model.relations = append(model.relations, genField{
+			name: model.unique(belongsTo),
+			typ:  "*" + ref.name,
+			tag:  tag,
+		})
+
+		name, typ := inflection.Plural(model.name), "[]"+model.name
+		if model.uniqueColumn(fk.Column) {
+			name, typ = model.name, "*"+model.name
+		}
+		// Две ссылки на одну таблицу (sender_id, receiver_id) - SenderMessages, ReceiverMessages
+		if refCount[fk.RefTable] > 1 && prefix != ref.name {
+			name = prefix + name
+		}
+		ref.relations = append(ref.relations, genField{
+			name: ref.unique(name),
+			typ:  typ,
+			tag:  tag,
+		})
+	}
+}
+
+// Значения столбца не повторяются: первичный ключ, UNIQUE или уникальный индекс
+// только по этому столбцу
+func (m *genModel) uniqueColumn(name string) bool {
+	if column, ok := m.table.Column(name); ok && (column.Unique || column.PrimaryKey) {
+		return true
+	}
+	for _, index := range m.table.Indexes {
+		if index.Unique && len(index.Columns) == 1 && index.Columns[0] == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Свободное имя поля: при совпадении добавляется номер
+func (m *genModel) unique(name string) string {
+	candidate := name
+	for i := 2; m.used[candidate] || candidate == "TableName"; i++ {
+		candidate = fmt.Sprintf("%s%d", name, i)
+	}
+	m.used[candidate] = true
+	return candidate
+}
+
+func (m *genModel) render(db *gorm.DB, pkg string) ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s\n// Таблица: %s\n\npackage %s\n\n", genHeader, m.table.Name, pkg)
+
+	if len(m.imports) > 0 {
+		imports := make([]string, 0, len(m.imports))
+		for path := range m.imports {
+			imports = append(imports, path)
+		}
+		sort.Strings(imports)
+		b.WriteString("import (\n")
+		for _, path := range imports {
+			fmt.Fprintf(&b, "%q\n", path)
+		}
+		b.WriteString(")\n\n")
+	}
+
+	fmt.Fprintf(&b, "type %s struct {\n", m.name)
+	if m.embedModel {
+		b.WriteString("gorm.Model\n")
+	}
+	for _, field := range m.fields {
+		fmt.Fprintf(&b, "%s %s `%s` %s\n", field.name, field.typ, field.tag, field.comment)
+	}
+	if len(m.relations) > 0 {
+		b.WriteString("\n")
+	}
+	for _, field := range m.relations {
+		fmt.Fprintf(&b, "%s %s `%s`\n", field.name, field.typ, field.tag)
+	}
+	b.WriteString("}\n")
+
+	// Имя таблицы не совпадает с тем, что выведет GORM
+	if db.NamingStrategy.TableName(m.name) != m.table.Name {
+		fmt.Fprintf(&b, "\nfunc (%s) TableName() string {\nreturn %q\n}\n", m.name, m.table.Name)
+	}
+
+	return format.Source(b.Bytes())
+}
+
+// Аббревиатуры, которые в Go пишут заглавными
+var initialisms = map[string]string{
+	"id": "ID", "url": "URL", "uri": "URI", "api": "API", "http": "HTTP", "json": "JSON",
+	"uuid": "UUID", "sql": "SQL", "ip": "IP", "html": "HTML", "xml": "XML",
+}
+
+// user_comment_count -> UserCommentCount, post_id -> PostID
+func goName(name string) string {
+	var b strings.Builder
+	for _, part := range strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	}) {
+		if upper, ok := initialisms[part]; ok {
+			b.WriteString(upper)
+			continue
+		}
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+
+	result := b.String()
+	if result == "" || result[0] >= '0' && result[0] <= '9' {
+		result = "X" + result
+	}
+	return result
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// gen models -dsn с файлом SQLite: база приложения не нужна
+func TestGenModelsSQLiteDSN(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "legacy.db")
+	legacy, err := gorm.Open(openDialector(path), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := legacy.AutoMigrate(&Post{}, &Comment{}); err != nil {
+		t.Fatal(err)
+	}
+	if sqlDB, err := legacy.DB(); err == nil {
+		sqlDB.Close()
+	}
+
+	dir := filepath.Join(t.TempDir(), "models")
+	if err := genCommand(nil, []string{"models", "-dsn=" + path, "-dir=" + dir, "-tables=posts,comments"}); err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := os.ReadFile(filepath.Join(dir, "posts_gen.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"package models", "type Post struct", "Comments []Comment"} {
+		if !strings.Contains(string(code), want) {
+			t.Errorf("в posts_gen.go нет %q:\n%s", want, code)
+		}
+	}
+}
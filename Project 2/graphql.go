@@ -0,0 +1,452 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/graphql-go/graphql"
+	"gorm.io/gorm"
+)
+
+// GraphQL поверх User -> Posts -> Comments (+ Address, Company).
+//
+// Вложенные поля загружаются пачками (DataLoader): резолвер не ходит в базу,
+// а регистрирует ключ и возвращает thunk. graphql-go вызывает thunk'и
+// после обхода всего уровня, и первый из них загружает все ключи одним
+// запросом: comments для 100 постов - один SELECT ... WHERE post_id IN (...).
+//
+//	{
+//	  users(limit: 5, search: "le") {
+//	    name
+//	    company { name }
+//	    posts(limit: 2) { title comments(limit: 3) { email } }
+//	  }
+//	}
+
+// Загрузчик пачками, создается на каждый запрос (кеш живет один запрос)
+type Loader[K comparable, V any] struct {
+	batch func(keys []K) (map[K]V, error)
+
+	mu      sync.Mutex
+	pending []K
+	queued  map[K]bool
+	cache   map[K]V
+	errs    map[K]error
+}
+
+func NewLoader[K comparable, V any](batch func(keys []K) (map[K]V, error)) *Loader[K, V] {
+	return &Loader[K, V]{
+		batch:  batch,
+		queued: map[K]bool{},
+		cache:  map[K]V{},
+		errs:   map[K]error{},
+	}
+}
+
+// Регистрирует ключ; значение будет загружено при первом вызове thunk
+func (l *Loader[K, V]) Load(key K) func() (V, error) {
+	l.mu.Lock()
+	if _, ok := l.cache[key]; !ok && !l.queued[key] {
+		l.queued[key] = true
+		l.pending = append(l.pending, key)
+	}
+	l.mu.Unlock()
+
+	return func() (V, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		if l.queued[key] {
+			l.dispatch()
+		}
+		return l.cache[key], l.errs[key]
+	}
+}
+
+// Загрузка всех накопленных ключей; ключи без результата получают нулевое значение
+func (l *Loader[K, V]) dispatch() {
+	keys := l.pending
+	l.pending = nil
+
+	result, err := l.batch(keys)
+	for _, key := range keys {
+		delete(l.queued, key)
+		if err != nil {
+			l.errs[key] = err
+			continue
+		}
+		l.cache[key] = result[key]
+	}
+}
+
+type gqlLoaders struct {
+	users          *Loader[uint, User]
+	addressByUser  *Loader[uint, *UserAddress]
+	companyByUser  *Loader[uint, *UserCompany]
+	postsByUser    *Loader[uint, []Post]
+	commentsByPost *Loader[uint, []Comment]
+}
+
+type gqlLoadersKey struct{}
+
+func newGQLLoaders(db *gorm.DB) *gqlLoaders {
+	return &gqlLoaders{
+		users: NewLoader(func(ids []uint) (map[uint]User, error) {
+			var users []User
+			err := db.Where("id IN ?", ids).Find(&users).Error
+			result := map[uint]User{}
+			for _, user := range users {
+				result[user.ID] = user
+			}
+			return result, err
+		}),
+		addressByUser: NewLoader(func(ids []uint) (map[uint]*UserAddress, error) {
+			var addresses []*UserAddress
+			err := db.Where("user_id IN ?", ids).Find(&addresses).Error
+			result := map[uint]*UserAddress{}
+			for _, address := range addresses {
+				result[address.UserID] = address
+			}
+			return result, err
+		}),
+		companyByUser: NewLoader(func(ids []uint) (map[uint]*UserCompany, error) {
+			var companies []*UserCompany
+			err := db.Where("user_id IN ?", ids).Find(&companies).Error
+			result := map[uint]*UserCompany{}
+			for _, company := range companies {
+				result[company.UserID] = company
+			}
+			return result, err
+		}),
+		postsByUser: NewLoader(func(ids []uint) (map[uint][]Post, error) {
+			var posts []Post
+			err := db.Where("user_id IN ?", ids).Order("id").Find(&posts).Error
+			result := map[uint][]Post{}
+			for _, post := range posts {
+				result[post.UserID] = append(result[post.UserID], post)
+			}
+			return result, err
+		}),
+		commentsByPost: NewLoader(func(ids []uint) (map[uint][]Comment, error) {
+			var comments []Comment
+			err := db.Where("post_id IN ?", ids).Order("id").Find(&comments).Error
+			result := map[uint][]Comment{}
+			for _, comment := range comments {
+				result[comment.PostID] = append(result[comment.PostID], comment)
+			}
+			return result, err
+		}),
+	}
+}
+
+func loadersFrom(ctx context.Context) *gqlLoaders {
+	return ctx.Value(gqlLoadersKey{}).(*gqlLoaders)
+}
+
+// Thunk в формате graphql-go
+func thunk[V any](load func() (V, error)) func() (interface{}, error) {
+	return func() (interface{}, error) {
+		return load()
+	}
+}
+
+// Пользователь по ID; несуществующий - null
+func loadUser(ctx context.Context, id uint) func() (interface{}, error) {
+	load := loadersFrom(ctx).users.Load(id)
+	return func() (interface{}, error) {
+		user, err := load()
+		if err != nil || user.ID == 0 {
+			return nil, err
+		}
+		return user, nil
+	}
+}
+
+// limit/offset для вложенных списков применяются после загрузки пачкой;
+// границы проверяет pageBounds, как и для корневых списков
+func page[T any](items []T, limit, offset int) []T {
+	if offset >= len(items) {
+		return nil
+	}
+	items = items[offset:]
+	if limit < len(items) {
+		items = items[:limit]
+	}
+	return items
+}
+
+const gqlMaxLimit = 100
+
+var pageArgs = graphql.FieldConfigArgument{
+	"limit":  &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 20},
+	"offset": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 0},
+}
+
+func withArgs(args graphql.FieldConfigArgument, extra graphql.FieldConfigArgument) graphql.FieldConfigArgument {
+	result := graphql.FieldConfigArgument{}
+	for name, arg := range args {
+		result[name] = arg
+	}
+	for name, arg := range extra {
+		result[name] = arg
+	}
+	return result
+}
+
+// Проверка limit/offset для всех списков
+func pageBounds(args map[string]interface{}) (limit, offset int, err error) {
+	limit, _ = args["limit"].(int)
+	offset, _ = args["offset"].(int)
+	if limit <= 0 || limit > gqlMaxLimit {
+		return 0, 0, fmt.Errorf("limit должен быть от 1 до %d", gqlMaxLimit)
+	}
+	if offset < 0 {
+		return 0, 0, errors.New("offset не может быть отрицательным")
+	}
+	return limit, offset, nil
+}
+
+// LIMIT/OFFSET для корневых списков
+func paginate(query *gorm.DB, args map[string]interface{}) (*gorm.DB, error) {
+	limit, offset, err := pageBounds(args)
+	if err != nil {
+		return nil, err
+	}
+	return query.Limit(limit).Offset(offset), nil
+}
+
+func newGraphQLSchema(db *gorm.DB) (graphql.Schema, error) {
+	addressType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Address",
+		Fields: graphql.Fields{
+			"street":  &graphql.Field{Type: graphql.String},
+			"suite":   &graphql.Field{Type: graphql.String},
+			"city":    &graphql.Field{Type: graphql.String},
+			"zipcode": &graphql.Field{Type: graphql.String},
+			"lat":     &graphql.Field{Type: graphql.String},
+			"lng":     &graphql.Field{Type: graphql.String},
+		},
+	})
+
+	companyType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Company",
+		Fields: graphql.Fields{
+			"name":        &graphql.Field{Type: graphql.String},
+			"catchPhrase": &graphql.Field{Type: graphql.String},
+			"bs":          &graphql.Field{Type: graphql.String},
+		},
+	})
+
+	// Типы ссылаются друг на друга, поэтому поля задаются функциями
+	var userType, postType, commentType *graphql.Object
+
+	commentType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Comment",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+				"postId": &graphql.Field{Type: graphql.Int, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(Comment).PostID, nil
+				}},
+				"name":  &graphql.Field{Type: graphql.String},
+				"email": &graphql.Field{Type: graphql.String},
+				"body":  &graphql.Field{Type: graphql.String},
+			}
+		}),
+	})
+
+	postType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Post",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":    &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+				"title": &graphql.Field{Type: graphql.String},
+				"body":  &graphql.Field{Type: graphql.String},
+				"version": &graphql.Field{Type: graphql.Int, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return int(p.Source.(Post).Version), nil
+				}},
+				"user": &graphql.Field{Type: userType, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return loadUser(p.Context, p.Source.(Post).UserID), nil
+				}},
+				"comments": &graphql.Field{
+					Type: graphql.NewList(commentType),
+					Args: pageArgs,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						limit, offset, err := pageBounds(p.Args)
+						if err != nil {
+							return nil, err
+						}
+						load := loadersFrom(p.Context).commentsByPost.Load(p.Source.(Post).ID)
+						return func() (interface{}, error) {
+							comments, err := load()
+							return page(comments, limit, offset), err
+						}, nil
+					},
+				},
+			}
+		}),
+	})
+
+	userType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "User",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":       &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+				"name":     &graphql.Field{Type: graphql.String},
+				"username": &graphql.Field{Type: graphql.String},
+				"email":    &graphql.Field{Type: graphql.String},
+				"phone":    &graphql.Field{Type: graphql.String},
+				"website":  &graphql.Field{Type: graphql.String},
+				"address": &graphql.Field{Type: addressType, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return thunk(loadersFrom(p.Context).addressByUser.Load(p.Source.(User).ID)), nil
+				}},
+				"company": &graphql.Field{Type: companyType, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return thunk(loadersFrom(p.Context).companyByUser.Load(p.Source.(User).ID)), nil
+				}},
+				"posts": &graphql.Field{
+					Type: graphql.NewList(postType),
+					Args: pageArgs,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						limit, offset, err := pageBounds(p.Args)
+						if err != nil {
+							return nil, err
+						}
+						load := loadersFrom(p.Context).postsByUser.Load(p.Source.(User).ID)
+						return func() (interface{}, error) {
+							posts, err := load()
+							return page(posts, limit, offset), err
+						}, nil
+					},
+				},
+			}
+		}),
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"users": &graphql.Field{
+				Type: graphql.NewList(userType),
+				Args: withArgs(pageArgs, graphql.FieldConfigArgument{
+					"search": &graphql.ArgumentConfig{Type: graphql.String, Description: "часть имени или username"},
+				}),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					query := db.WithContext(p.Context).Order("id")
+					if search, ok := p.Args["search"].(string); ok && search != "" {
+						pattern := "%" + search + "%"
+						query = query.Where("LOWER(name) LIKE LOWER(?) OR LOWER(username) LIKE LOWER(?)", pattern, pattern)
+					}
+					query, err := paginate(query, p.Args)
+					if err != nil {
+						return nil, err
+					}
+
+					var users []User
+					return users, query.Find(&users).Error
+				},
+			},
+			"user": &graphql.Field{
+				Type: userType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return loadUser(p.Context, uint(p.Args["id"].(int))), nil
+				},
+			},
+			"posts": &graphql.Field{
+				Type: graphql.NewList(postType),
+				Args: withArgs(pageArgs, graphql.FieldConfigArgument{
+					"userId": &graphql.ArgumentConfig{Type: graphql.Int},
+					"search": &graphql.ArgumentConfig{Type: graphql.String, Description: "часть заголовка"},
+				}),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					query := db.WithContext(p.Context).Order("id")
+					if userID, ok := p.Args["userId"].(int); ok {
+						query = query.Where("user_id = ?", userID)
+					}
+					if search, ok := p.Args["search"].(string); ok && search != "" {
+						query = query.Where("LOWER(title) LIKE LOWER(?)", "%"+search+"%")
+					}
+					query, err := paginate(query, p.Args)
+					if err != nil {
+						return nil, err
+					}
+
+					var posts []Post
+					return posts, query.Find(&posts).Error
+				},
+			},
+			"post": &graphql.Field{
+				Type: postType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					var post Post
+					err := db.WithContext(p.Context).First(&post, p.Args["id"]).Error
+					if errors.Is(err, gorm.ErrRecordNotFound) {
+						return nil, nil
+					}
+					return post, err
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query})
+}
+
+// Выполнение запроса с новыми загрузчиками
+func executeGraphQL(ctx context.Context, db *gorm.DB, schema graphql.Schema, query string, variables map[string]interface{}, operation string) *graphql.Result {
+	ctx = context.WithValue(ctx, gqlLoadersKey{}, newGQLLoaders(db.WithContext(ctx)))
+	return graphql.Do(graphql.Params{
+		Schema:         schema,
+		RequestString:  query,
+		VariableValues: variables,
+		OperationName:  operation,
+		Context:        ctx,
+	})
+}
+
+func serveGraphQL(db *gorm.DB, addr string) {
+	schema, err := newGraphQLSchema(db)
+	if err != nil {
+		panic("Не удалось построить схему GraphQL: " + err.Error())
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		var input struct {
+			Query         string                 `json:"query"`
+			Variables     map[string]interface{} `json:"variables"`
+			OperationName string                 `json:"operationName"`
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			input.Query = r.URL.Query().Get("query")
+		case http.MethodPost:
+			if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		result := executeGraphQL(r.Context(), db, schema, input.Query, input.Variables, input.OperationName)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	})
+
+	fmt.Printf("GraphQL на http://localhost%s/graphql\n", addr)
+	if err := http.ListenAndServe(addr, tenantMiddleware(mux)); err != nil {
+		panic("Не удалось запустить HTTP сервер")
+	}
+}
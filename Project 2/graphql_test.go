@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestGraphQLNestedPage(t *testing.T) {
+	db := openTestDB(t, &User{}, &UserAddress{}, &UserCompany{}, &Post{}, &Comment{}, &OutboxEvent{})
+	user := User{Name: "GraphQL", Email: "graphql@example.com"}
+	for i := 1; i <= 3; i++ {
+		user.Posts = append(user.Posts, Post{Title: fmt.Sprint("post ", i)})
+	}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	schema, err := newGraphQLSchema(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	posts := func(args string) (int, string) {
+		t.Helper()
+		result := executeGraphQL(context.Background(), db, schema, "{ users { posts"+args+" { title } } }", nil, "")
+		if len(result.Errors) > 0 {
+			return 0, result.Errors[0].Message
+		}
+		users := result.Data.(map[string]interface{})["users"].([]interface{})
+		return len(users[0].(map[string]interface{})["posts"].([]interface{})), ""
+	}
+
+	for _, tc := range []struct {
+		args  string
+		count int
+		err   string
+	}{
+		{"", 3, ""},
+		{"(limit: 2)", 2, ""},
+		{"(limit: 2, offset: 2)", 1, ""},
+		{"(offset: 5)", 0, ""},
+		{"(offset: -1)", 0, "offset"},
+		{"(limit: 0)", 0, "limit"},
+		{fmt.Sprintf("(limit: %d)", gqlMaxLimit+1), 0, "limit"},
+	} {
+		count, message := posts(tc.args)
+		if count != tc.count || (tc.err == "") != (message == "") || !strings.Contains(message, tc.err) {
+			t.Errorf("posts%s: %d, %q; ожидалось %d, ошибка %q", tc.args, count, message, tc.count, tc.err)
+		}
+	}
+}
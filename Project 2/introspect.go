@@ -0,0 +1,188 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Структура таблиц в живой базе (Postgres или SQLite):
+// столбцы и индексы - через Migrator, внешние ключи - запросом к каталогу.
+
+type TableInfo struct {
+	Name        string
+	Columns     []ColumnInfo
+	Indexes     []IndexInfo
+	ForeignKeys []ForeignKeyInfo
+}
+
+type ColumnInfo struct {
+	Name          string
+	Type          string // тип в базе в нижнем регистре: integer, text, timestamptz...
+	Length        int64  // для varchar(n), иначе 0
+	Nullable      bool
+	PrimaryKey    bool
+	AutoIncrement bool
+	Unique        bool
+	Default       string // пусто - без значения по умолчанию
+}
+
+type IndexInfo struct {
+	Name       string
+	Columns    []string
+	Unique     bool
+	PrimaryKey bool
+}
+
+type ForeignKeyInfo struct {
+	Name      string
+	Column    string
+	RefTable  string
+	RefColumn string
+}
+
+func (t TableInfo) Column(name string) (ColumnInfo, bool) {
+	for _, column := range t.Columns {
+		if column.Name == name {
+			return column, true
+		}
+	}
+	return ColumnInfo{}, false
+}
+
+// Таблицы базы; tables - только перечисленные (пусто - все)
+func introspectDatabase(db *gorm.DB, tables []string) ([]TableInfo, error) {
+	if len(tables) == 0 {
+		all, err := db.Migrator().GetTables()
+		if err != nil {
+			return nil, err
+		}
+		for _, table := range all {
+			if !strings.HasPrefix(table, "sqlite_") {
+				tables = append(tables, table)
+			}
+		}
+	}
+	sort.Strings(tables)
+
+	foreignKeys, err := introspectForeignKeys(db, tables)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []TableInfo
+	for _, table := range tables {
+		info, err := introspectTable(db, table)
+		if err != nil {
+			return nil, err
+		}
+		info.ForeignKeys = foreignKeys[table]
+		result = append(result, info)
+	}
+	return result, nil
+}
+
+func introspectTable(db *gorm.DB, table string) (TableInfo, error) {
+	info := TableInfo{Name: table}
+
+	columnTypes, err := db.Migrator().ColumnTypes(table)
+	if err != nil {
+		return info, err
+	}
+	for _, columnType := range columnTypes {
+		column := ColumnInfo{
+			Name: columnType.Name(),
+			Type: strings.ToLower(columnType.DatabaseTypeName()),
+		}
+		column.Nullable, _ = columnType.Nullable()
+		column.PrimaryKey, _ = columnType.PrimaryKey()
+		column.AutoIncrement, _ = columnType.AutoIncrement()
+		column.Unique, _ = columnType.Unique()
+		if length, ok := columnType.Length(); ok && length > 0 && isTextType(column.Type) {
+			column.Length = length
+		}
+		if value, ok := columnType.DefaultValue(); ok {
+			column.Default = value
+		}
+		info.Columns = append(info.Columns, column)
+	}
+
+	indexes, err := db.Migrator().GetIndexes(table)
+	if err != nil {
+		return info, err
+	}
+	for _, index := range indexes {
+		unique, _ := index.Unique()
+		primaryKey, _ := index.PrimaryKey()
+		info.Indexes = append(info.Indexes, IndexInfo{
+			Name:       index.Name(),
+			Columns:    index.Columns(),
+			Unique:     unique,
+			PrimaryKey: primaryKey,
+		})
+	}
+	sort.Slice(info.Indexes, func(i, j int) bool {
+		return info.Indexes[i].Name < info.Indexes[j].Name
+	})
+
+	return info, nil
+}
+
+func isTextType(typ string) bool {
+	return strings.Contains(typ, "char") || typ == "text" || typ == "string"
+}
+
+// Внешние ключи по таблицам
+func introspectForeignKeys(db *gorm.DB, tables []string) (map[string][]ForeignKeyInfo, error) {
+	result := map[string][]ForeignKeyInfo{}
+
+	if db.Dialector.Name() == "postgres" {
+		var rows []struct {
+			TableName string
+			ForeignKeyInfo
+		}
+		err := db.Raw(`
+			SELECT tc.table_name, tc.constraint_name AS name, kcu.column_name AS "column",
+				ccu.table_name AS ref_table, ccu.column_name AS ref_column
+			FROM information_schema.table_constraints tc
+			JOIN information_schema.key_column_usage kcu
+				ON kcu.constraint_name = tc.constraint_name AND kcu.table_schema = tc.table_schema
+			JOIN information_schema.constraint_column_usage ccu
+				ON ccu.constraint_name = tc.constraint_name AND ccu.table_schema = tc.table_schema
+			WHERE tc.constraint_type = 'FOREIGN KEY' AND tc.table_schema = CURRENT_SCHEMA()
+			ORDER BY tc.table_name, tc.constraint_name`).Scan(&rows).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			result[row.TableName] = append(result[row.TableName], row.ForeignKeyInfo)
+		}
+		return result, nil
+	}
+
+	// SQLite: внешние ключи безымянные, имя составляем из таблицы и столбца
+	for _, table := range tables {
+		var rows []struct {
+			Table string `gorm:"column:table"`
+			From  string `gorm:"column:from"`
+			To    string `gorm:"column:to"`
+		}
+		if err := db.Raw("SELECT * FROM pragma_foreign_key_list(?)", table).Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			// Ссылка без столбца - на первичный ключ
+			if row.To == "" {
+				row.To = "id"
+			}
+			result[table] = append(result[table], ForeignKeyInfo{
+				Name:      "fk_" + table + "_" + row.From,
+				Column:    row.From,
+				RefTable:  row.Table,
+				RefColumn: row.To,
+			})
+		}
+	}
+	return result, nil
+}
@@ -1,58 +1,68 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"net/http"
+	"os"
+	"strings"
 )
 
 type User struct {
-	ID       uint `gorm:"primaryKey"`
-	Name     string
-	Username string
-	Email    string
+	ID       uint   `gorm:"primaryKey"`
+	TenantID string `gorm:"index;uniqueIndex:idx_users_tenant_email,priority:1"` // арендатор (tenancy.go)
+	Name     string `validate:"required,max=100"`
+	Username string `validate:"max=50"`
+	Email    string `gorm:"not null;uniqueIndex:idx_users_tenant_email,priority:2;check:chk_users_email,email LIKE '%@%'" validate:"required,email"` // уникален в пределах арендатора
 	Phone    string
-	Website  string
-	Address  UserAddress `gorm:"foreignKey:UserID"` // one-to-one
-	Company  UserCompany `gorm:"foreignKey:UserID"` // one-to-one
-	Posts    []Post      `gorm:"foreignKey:UserID"` // one-to-many
+	Website  string      `validate:"url"`
+	Address  UserAddress `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"` // one-to-one
+	Company  UserCompany `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"` // one-to-one
+	Posts    []Post      `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"` // one-to-many
 }
 
 type UserAddress struct {
-	ID      uint `gorm:"primaryKey"`
-	UserID  uint // Внешний ключ
-	Street  string
-	Suite   string
-	City    string
-	Zipcode string
-	Lat     string
-	Lng     string
+	ID       uint   `gorm:"primaryKey"`
+	TenantID string `gorm:"index"`                // арендатор (tenancy.go)
+	UserID   uint   `gorm:"not null;uniqueIndex"` // Внешний ключ, один адрес на пользователя
+	Street   string
+	Suite    string
+	City     string
+	Zipcode  string
+	Lat      string
+	Lng      string
 }
 
 type UserCompany struct {
-	ID          uint `gorm:"primaryKey"`
-	UserID      uint // Внешний ключ
+	ID          uint   `gorm:"primaryKey"`
+	TenantID    string `gorm:"index"`                // арендатор (tenancy.go)
+	UserID      uint   `gorm:"not null;uniqueIndex"` // Внешний ключ, одна компания на пользователя
 	Name        string
 	CatchPhrase string
 	Bs          string
 }
 
 type Post struct {
-	ID       uint `gorm:"primaryKey"`
-	UserID   uint // Внешний ключ
-	Title    string
+	ID       uint   `gorm:"primaryKey"`
+	TenantID string `gorm:"index"`          // арендатор (tenancy.go)
+	UserID   uint   `gorm:"not null;index"` // Внешний ключ
+	Title    string `gorm:"not null;check:chk_posts_title,title <> ''" validate:"required,max=255"`
 	Body     string
-	Comments []Comment // one-to-many
+	Version  Version   `gorm:"not null;default:1"`                           // оптимистическая блокировка
+	Comments []Comment `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"` // one-to-many
 }
 
 type Comment struct {
-	ID     uint `gorm:"primaryKey"`
-	PostID uint `gorm:"foreignKey:PostID"` // Внешний ключ
-	Name   string
-	Email  string
-	Body   string
+	ID       uint   `gorm:"primaryKey"`
+	TenantID string `gorm:"index"`          // арендатор (tenancy.go)
+	PostID   uint   `gorm:"not null;index"` // Внешний ключ
+	Name     string
+	Email    string `validate:"email"`
+	Body     string `validate:"required"`
 }
 
 func autoMigrate(db *gorm.DB) {
@@ -62,6 +72,14 @@ func autoMigrate(db *gorm.DB) {
 	db.AutoMigrate(&UserCompany{})
 	db.AutoMigrate(&Post{})
 	db.AutoMigrate(&Comment{})
+	db.AutoMigrate(&OutboxEvent{})
+	db.AutoMigrate(&UserCredential{})
+	db.AutoMigrate(&AuthSession{})
+
+	// Триггеры ленты изменений posts и comments (changefeed.go)
+	if err := installChangeFeed(db); err != nil {
+		fmt.Println("Не удалось установить ленту изменений:", err)
+	}
 	fmt.Println("Таблицы успешно созданы.")
 }
 
@@ -243,7 +261,9 @@ func usersPart(db *gorm.DB, userID uint) {
 		Company  string
 	}
 
+	// Table + Scan плагин арендаторов не видит - фильтр задается явно (tenancy.go)
 	db.Table("users").
+		Scopes(TenantScope("users")).
 		Select("users.id, users.name, users.username, user_addresses.city, user_addresses.zipcode, user_companies.name").
 		Joins("LEFT JOIN user_addresses ON users.id = user_addresses.user_id").
 		Joins("LEFT JOIN user_companies ON users.id = user_companies.user_id").
@@ -360,7 +380,7 @@ func GetPostCountByUser(db *gorm.DB) []PostCountByUser {
 	db.Model(&Post{}).
 		Select("user_id, COUNT(*) as post_count").
 		Group("user_id").
-		Scan(&result)
+		Find(&result) // Find, а не Scan: результат можно кешировать (cache.go)
 
 	for _, user := range result {
 		fmt.Printf("user_id: %d\n", user.UserID)
@@ -388,9 +408,9 @@ func GetUserDataWithPostCount(db *gorm.DB) []UserDataWithPostCount {
 
 	db.Model(&User{}).
 		Select("users.id as user_id, users.name, COALESCE(COUNT(posts.id), 0) as post_count").
-		Joins("LEFT JOIN posts ON users.id = posts.user_id").
+		Joins("LEFT JOIN posts ON users.id = posts.user_id AND posts.tenant_id = users.tenant_id").
 		Group("users.id").
-		Scan(&result)
+		Find(&result)
 
 	for _, user := range result {
 		fmt.Printf("user_id: %d\n", user.UserID)
@@ -448,8 +468,8 @@ func GetUserCommentCount(db *gorm.DB) []UserCommentCount {
 
 	db.Model(&Comment{}).
 		Select("users.id as user_id, users.name as name, COUNT(*) as comment_count").
-		Joins("LEFT JOIN posts ON comments.post_id = posts.id").
-		Joins("LEFT JOIN users ON posts.user_id = users.id").
+		Joins("LEFT JOIN posts ON comments.post_id = posts.id AND posts.tenant_id = comments.tenant_id").
+		Joins("LEFT JOIN users ON posts.user_id = users.id AND users.tenant_id = posts.tenant_id").
 		Group("users.id").
 		Scan(&result)
 
@@ -477,8 +497,8 @@ func GetUserCommentPostData(db *gorm.DB) []UserCommentPostData {
 
 	db.Model(&Comment{}).
 		Select("users.id as user_id, users.name as user_name, posts.id as post_id, posts.title as post_title, comments.id as comment_id, comments.body as comment_body").
-		Joins("LEFT JOIN posts ON comments.post_id = posts.id").
-		Joins("LEFT JOIN users ON posts.user_id = users.id").
+		Joins("LEFT JOIN posts ON comments.post_id = posts.id AND posts.tenant_id = comments.tenant_id").
+		Joins("LEFT JOIN users ON posts.user_id = users.id AND users.tenant_id = posts.tenant_id").
 		Scan(&result)
 
 	for _, data := range result {
@@ -504,17 +524,26 @@ type UserPost struct {
 func FindTop3PostsPerUser(db *gorm.DB) []UserPost {
 	var result []UserPost
 
+	// Raw-запрос плагин арендаторов не видит: фильтр по users
+	// и соединение с posts по tenant_id (tenancy.go)
+	tenant, err := TenantCondition(db, "u")
+	if err != nil {
+		fmt.Println("Ошибка:", err)
+		return nil
+	}
+
 	// SQL-запрос для выбора трех первых постов каждого пользователя
 	query := `
         SELECT u.id as user_id, u.name as user_name, p.id as post_id, p.title as post_title
         FROM users u
         INNER JOIN (
-            SELECT user_id, id, title, ROW_NUMBER() OVER (PARTITION BY user_id ORDER BY id) as row_num
+            SELECT tenant_id, user_id, id, title, ROW_NUMBER() OVER (PARTITION BY tenant_id, user_id ORDER BY id) as row_num
             FROM posts
-        ) p ON u.id = p.user_id AND p.row_num <= 3
+        ) p ON u.id = p.user_id AND p.tenant_id = u.tenant_id AND p.row_num <= 3
+        WHERE ?
     `
 
-	db.Raw(query).Scan(&result)
+	db.Raw(query, tenant).Scan(&result)
 
 	for _, data := range result {
 		fmt.Printf("user.id: %d\n", data.UserID)
@@ -541,13 +570,13 @@ func FindMatchingEmails(db *gorm.DB) []UserCommentMatch {
 
 	db.Model(&User{}).
 		Select("users.id as user_id, users.name as user_name, users.email as user_email, comments.id as comment_id, comments.body as comment_body, comments.email as comment_email").
-		Joins("LEFT JOIN comments ON users.email = comments.email"). //INNER
+		Joins("LEFT JOIN comments ON users.email = comments.email AND comments.tenant_id = users.tenant_id"). //INNER
 		Scan(&result)
 
 	for _, data := range result {
 		fmt.Printf("user.id: %d\n", data.UserID)
 		fmt.Printf("user.name: %s\n", data.UserName)
-		fmt.Printf("post.email: %d\n", data.UserEmail)
+		fmt.Printf("post.email: %s\n", data.UserEmail)
 		fmt.Printf("comment.id: %d\n", data.CommentID)
 		fmt.Printf("comment.email: %s\n", data.CommentEmail)
 		//fmt.Printf("comment.body: %s\n", data.CommentBody)
@@ -575,14 +604,73 @@ func FindCommentsByBodyKeyword(db *gorm.DB, keyword string) []Comment {
 	return comments
 }
 
+// Драйвер по строке подключения: файл SQLite (*.db, *.sqlite, file:...)
+// или Postgres (host=... или postgres://...)
+func openDialector(dsn string) gorm.Dialector {
+	if strings.HasPrefix(dsn, "file:") || strings.HasSuffix(dsn, ".db") || strings.HasSuffix(dsn, ".sqlite") {
+		return sqlite.Open(dsn)
+	}
+	return postgres.Open(dsn)
+}
+
 func main() {
+	// Команды, которым база не нужна: go run . openapi
+	if runOfflineCommand(os.Args[1:]) {
+		return
+	}
+
 	// Настроим соединение с базой данных PostgreSQL
-	dsn := "host=localhost user=postgres password=root dbname=jsonplaceholder port=5432 sslmode=disable"
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	// (или SQLite: DATABASE_DSN=jsonplaceholder.db go run .)
+	dsn := os.Getenv("DATABASE_DSN")
+	if dsn == "" {
+		dsn = "host=localhost user=postgres password=root dbname=jsonplaceholder port=5432 sslmode=disable"
+	}
+	db, err := gorm.Open(openDialector(dsn), &gorm.Config{})
 	if err != nil {
 		panic("Не удалось подключиться к базе данных")
 	}
 
+	// Проверка версии при обновлении моделей с полем Version
+	db.Use(OptimisticLockPlugin{})
+
+	// Арендаторы (tenancy.go): TENANT_ID=team_a go run . - только данные team_a,
+	// без TENANT_ID - все арендаторы (миграции, загрузка данных, отчеты).
+	// HTTP API берут арендатора из заголовка X-Tenant-ID.
+	db.Use(TenantPlugin{})
+	ctx := WithoutTenant(context.Background())
+	if tenant := os.Getenv("TENANT_ID"); tenant != "" {
+		ctx = WithTenant(context.Background(), tenant)
+	}
+	db = db.WithContext(ctx)
+
+	// Команды: go run . export / import ...
+	if runCommand(db, os.Args[1:]) {
+		return
+	}
+
+	//// Метрики Prometheus на http://localhost:2112/metrics
+	//metrics := NewMetricsPlugin(prometheus.NewRegistry(), "jsonplaceholder")
+	//db.Use(metrics)
+	//go serveMetrics(metrics, ":2112")
+
+	//// Трассировка OpenTelemetry (span'ы выводятся в консоль)
+	//exporter, _ := stdouttrace.New(stdouttrace.WithPrettyPrint())
+	//provider := newTracerProvider(exporter)
+	//db.Use(NewTracingPlugin(provider))
+	//go serveTracedAPI(db, ":8080")
+
+	//// API с входом по паролю: менять пост и его комментарии может только автор
+	//go serveAuthAPI(db, ":8081")
+
+	//// GraphQL: users -> posts -> comments, вложенные поля загружаются пачками
+	//go serveGraphQL(db, ":8082")
+
+	//// Чтение с реплик, запись и транзакции - в основную базу
+	//replicaDSN := "host=localhost user=postgres password=root dbname=jsonplaceholder port=5433 sslmode=disable"
+	//policy, _ := useReplicas(db, RoundRobin, replicaDSN)
+	//go policy.watch(ctx, 5*time.Second)
+	//exampleReplicas(db)
+
 	//// Автомиграция - создание таблиц
 	//autoMigrate(db)
 	//
@@ -597,6 +685,25 @@ func main() {
 	//	return
 	//}
 
+	//// Лента изменений posts и comments (LISTEN/NOTIFY, в SQLite - опрос журнала)
+	//go exampleChangeFeed(db, dsn)
+
+	//// Outbox: события о новых пользователях доставляются на webhook
+	//go serveWebhookStub(":9090")
+	//go NewOutboxRelay(db, WebhookSink{URL: "http://localhost:9090/events"}).Run(ctx)
+
+	//// Арендаторы: tenant_id из контекста запроса, схема на арендатора
+	//exampleTenancy(db)
+
+	//// Поиск N+1 запросов (для разработки)
+	//exampleNPlusOne(db)
+
+	//// Кеш отчетов с LRU и сбросом при изменении таблиц
+	//exampleQueryCache(db)
+
+	//// Проверка данных перед сохранением
+	//exampleValidation(db)
+
 	//// Чтение данных
 	//usersALL(db)
 	//usersPart(db, 1)
@@ -609,9 +716,20 @@ func main() {
 	//GetUsersWithLimitAndOffset(db, 2, 2)
 	//GetCommentsWithLimitAndOffset(db, 10, 20)
 	//FindTop3PostsPerUser(db)
+	//FindTopPostsPerUser(db, 3)
+	//FindLatestCommentsPerPost(db, 2)
 	//GetUserCommentCount(db)
 	//GetUserCommentPostData(db)
+	//usersALLStream(ctx, db)
+	//for data, err := range StreamUserCommentPostData(ctx, db) {
+	//	if err != nil {
+	//		break
+	//	}
+	//	fmt.Println(data.UserName, data.PostTitle, data.CommentID)
+	//}
 	//FindMatchingEmails(db)
+	//report := GetUserEngagementReport(db)
+	//exportEngagementReport(report, ".")
 	FindCommentsByBodyKeyword(db, "molestiae ")
 
 	fmt.Println("END")
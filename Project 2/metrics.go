@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gorm.io/gorm"
+)
+
+// MetricsPlugin - плагин GORM, который собирает метрики Prometheus:
+// количество запросов по модели и операции, время выполнения,
+// ошибки по типам и состояние пула соединений (sql.DBStats).
+type MetricsPlugin struct {
+	Registry *prometheus.Registry
+	DBName   string
+
+	queries  *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	errors   *prometheus.CounterVec
+}
+
+const metricsStartKey = "metrics:start"
+
+func NewMetricsPlugin(registry *prometheus.Registry, dbName string) *MetricsPlugin {
+	return &MetricsPlugin{
+		Registry: registry,
+		DBName:   dbName,
+		queries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gorm_queries_total",
+			Help: "Количество запросов по модели и операции.",
+		}, []string{"model", "operation"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "gorm_query_duration_seconds",
+			Help:    "Время выполнения запросов по модели и операции.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"model", "operation"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gorm_query_errors_total",
+			Help: "Количество ошибок по модели, операции и типу ошибки.",
+		}, []string{"model", "operation", "type"}),
+	}
+}
+
+func (p *MetricsPlugin) Name() string {
+	return "metrics"
+}
+
+func (p *MetricsPlugin) Initialize(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+
+	p.Registry.MustRegister(
+		p.queries,
+		p.duration,
+		p.errors,
+		// Открытые, занятые и свободные соединения, ожидания пула и т.д.
+		collectors.NewDBStatsCollector(sqlDB, p.DBName),
+	)
+
+	// Регистрируем колбэки до и после каждой операции
+	cb := db.Callback()
+	operations := []struct {
+		name   string
+		before func(name string, fn func(*gorm.DB)) error
+		after  func(name string, fn func(*gorm.DB)) error
+	}{
+		{"create", cb.Create().Before("gorm:create").Register, cb.Create().After("gorm:create").Register},
+		{"query", cb.Query().Before("gorm:query").Register, cb.Query().After("gorm:query").Register},
+		{"update", cb.Update().Before("gorm:update").Register, cb.Update().After("gorm:update").Register},
+		{"delete", cb.Delete().Before("gorm:delete").Register, cb.Delete().After("gorm:delete").Register},
+		{"row", cb.Row().Before("gorm:row").Register, cb.Row().After("gorm:row").Register},
+		{"raw", cb.Raw().Before("gorm:raw").Register, cb.Raw().After("gorm:raw").Register},
+	}
+
+	for _, op := range operations {
+		if err := op.before("metrics:before_"+op.name, p.before); err != nil {
+			return err
+		}
+		if err := op.after("metrics:after_"+op.name, p.after(op.name)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *MetricsPlugin) before(db *gorm.DB) {
+	db.InstanceSet(metricsStartKey, time.Now())
+}
+
+func (p *MetricsPlugin) after(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		model := metricsModelName(db)
+
+		p.queries.WithLabelValues(model, operation).Inc()
+
+		if start, ok := db.InstanceGet(metricsStartKey); ok {
+			p.duration.WithLabelValues(model, operation).Observe(time.Since(start.(time.Time)).Seconds())
+		}
+
+		if db.Error != nil {
+			p.errors.WithLabelValues(model, operation, metricsErrorType(db.Error)).Inc()
+		}
+	}
+}
+
+// Имя модели: схема (User, Post...), иначе имя таблицы (для Raw и Table)
+func metricsModelName(db *gorm.DB) string {
+	if db.Statement.Schema != nil {
+		return db.Statement.Schema.Name
+	}
+	if db.Statement.Table != "" {
+		return db.Statement.Table
+	}
+	return "unknown"
+}
+
+// Тип ошибки для метки "type"
+func metricsErrorType(err error) string {
+	var pgErr *pgconn.PgError
+
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return "not_found"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.As(err, &pgErr):
+		// Код SQLSTATE, например 23505 - нарушение уникальности
+		return "pg_" + pgErr.Code
+	default:
+		return "other"
+	}
+}
+
+// Обработчик /metrics, его же вызывает тест через httptest (metrics_test.go)
+func metricsHandler(p *MetricsPlugin) http.Handler {
+	return promhttp.HandlerFor(p.Registry, promhttp.HandlerOpts{})
+}
+
+func serveMetrics(p *MetricsPlugin, addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metricsHandler(p))
+
+	fmt.Printf("Метрики доступны на http://localhost%s/metrics\n", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		panic("Не удалось запустить сервер метрик")
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestMetricsScrape(t *testing.T) {
+	db := openTestDB(t, &Post{})
+	plugin := NewMetricsPlugin(prometheus.NewRegistry(), "test")
+	if err := db.Use(plugin); err != nil {
+		t.Fatal(err)
+	}
+
+	db.Create(&Post{UserID: 1, Title: "metrics"})
+	var posts []Post
+	db.Find(&posts)
+	db.First(&Post{}, 999) // not found
+
+	recorder := httptest.NewRecorder()
+	metricsHandler(plugin).ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body := recorder.Body.String()
+
+	for _, series := range []string{
+		`gorm_queries_total{model="Post",operation="create"} 1`,
+		`gorm_queries_total{model="Post",operation="query"} 2`,
+		`gorm_query_duration_seconds_count{model="Post",operation="query"} 2`,
+		`gorm_query_duration_seconds_bucket{model="Post",operation="query",le="+Inf"} 2`,
+		`gorm_query_errors_total{model="Post",operation="query",type="not_found"} 1`,
+		`go_sql_max_open_connections{db_name="test"}`,
+		`go_sql_open_connections{db_name="test"}`,
+	} {
+		if !strings.Contains(body, series) {
+			t.Errorf("нет %s в ответе /metrics:\n%s", series, body)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// Поиск N+1 запросов (для разработки). Запросы считаются в рамках операции
+// (HTTP-запрос, тест, функция), запросы с одинаковым SQL, отличающиеся
+// только параметрами, группируются. Если такой запрос выполнен
+// Threshold раз и больше - это, скорее всего, запрос в цикле,
+// который надо заменить на Preload или IN (...).
+//
+//	ctx, tracker := TrackQueries(context.Background(), "usersWithPosts")
+//	usersWithPosts(db.WithContext(ctx))
+//	tracker.Report(os.Stdout)
+//
+// В тесте:
+//
+//	if err := tracker.Err(5); err != nil {
+//		t.Fatal(err)
+//	}
+
+var ErrNPlusOne = errors.New("повторяющийся запрос (N+1)")
+
+type NPlusOneDetector struct {
+	Threshold int  // с какого числа повторов сообщать (по умолчанию 5)
+	Strict    bool // запросы начиная с порогового завершаются ошибкой ErrNPlusOne
+}
+
+func (NPlusOneDetector) Name() string {
+	return "nplusone"
+}
+
+func (d NPlusOneDetector) Initialize(db *gorm.DB) error {
+	if d.Threshold <= 0 {
+		d.Threshold = 5
+	}
+
+	callbacks := db.Callback()
+	for _, err := range []error{
+		callbacks.Create().After("gorm:create").Register("nplusone:create", d.record),
+		callbacks.Query().After("gorm:query").Register("nplusone:query", d.record),
+		callbacks.Update().After("gorm:update").Register("nplusone:update", d.record),
+		callbacks.Delete().After("gorm:delete").Register("nplusone:delete", d.record),
+		callbacks.Row().After("gorm:row").Register("nplusone:row", d.record),
+		callbacks.Raw().After("gorm:raw").Register("nplusone:raw", d.record),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d NPlusOneDetector) record(db *gorm.DB) {
+	tracker, ok := db.Statement.Context.Value(queryTrackerKey{}).(*QueryTracker)
+	if !ok || db.Statement.SQL.Len() == 0 {
+		return
+	}
+
+	count := tracker.add(normalizeSQL(db.Statement.SQL.String()), callSite())
+	if d.Strict && count >= d.Threshold {
+		db.AddError(fmt.Errorf("%w: %d раз за операцию %s: %s",
+			ErrNPlusOne, count, tracker.Name, normalizeSQL(db.Statement.SQL.String())))
+	}
+}
+
+var (
+	pgPlaceholder = regexp.MustCompile(`\$\d+`)
+	placeholders  = regexp.MustCompile(`\?(\s*,\s*\?)+`)
+)
+
+// SQL без различий в параметрах: $1 -> ?, IN (?,?,?) -> IN (?)
+func normalizeSQL(sql string) string {
+	sql = pgPlaceholder.ReplaceAllString(sql, "?")
+	return placeholders.ReplaceAllString(sql, "?")
+}
+
+// Первое место в коде приложения, откуда пришел запрос
+func callSite() string {
+	pcs := make([]uintptr, 32)
+	// Пропускаем runtime.Callers, callSite и record
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	for {
+		frame, more := frames.Next()
+		if !strings.Contains(frame.File, "gorm.io/") {
+			return fmt.Sprintf("%s:%d", frame.File, frame.Line)
+		}
+		if !more {
+			return "?"
+		}
+	}
+}
+
+type queryTrackerKey struct{}
+
+type QueryTracker struct {
+	Name string
+
+	mu         sync.Mutex
+	total      int
+	statements map[string]*trackedStatement
+}
+
+type trackedStatement struct {
+	count     int
+	callSites map[string]int
+}
+
+// Одинаковый запрос, выполненный Count раз
+type NPlusOneFinding struct {
+	SQL       string
+	Count     int
+	CallSites []string // "файл:строка (N раз)", чаще всего - первые
+}
+
+func TrackQueries(ctx context.Context, name string) (context.Context, *QueryTracker) {
+	tracker := &QueryTracker{Name: name, statements: map[string]*trackedStatement{}}
+	return context.WithValue(ctx, queryTrackerKey{}, tracker), tracker
+}
+
+func (t *QueryTracker) add(sql, site string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.total++
+	stmt, ok := t.statements[sql]
+	if !ok {
+		stmt = &trackedStatement{callSites: map[string]int{}}
+		t.statements[sql] = stmt
+	}
+	stmt.count++
+	stmt.callSites[site]++
+	return stmt.count
+}
+
+// Всего запросов за операцию
+func (t *QueryTracker) Total() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.total
+}
+
+// Запросы, повторенные threshold раз и больше, от частых к редким
+func (t *QueryTracker) Findings(threshold int) []NPlusOneFinding {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var findings []NPlusOneFinding
+	for sql, stmt := range t.statements {
+		if stmt.count < threshold {
+			continue
+		}
+
+		sites := make([]string, 0, len(stmt.callSites))
+		for site := range stmt.callSites {
+			sites = append(sites, site)
+		}
+		sort.Slice(sites, func(i, j int) bool {
+			return stmt.callSites[sites[i]] > stmt.callSites[sites[j]]
+		})
+		for i, site := range sites {
+			sites[i] = fmt.Sprintf("%s (%d раз)", site, stmt.callSites[site])
+		}
+
+		findings = append(findings, NPlusOneFinding{SQL: sql, Count: stmt.count, CallSites: sites})
+	}
+
+	sort.Slice(findings, func(i, j int) bool {
+		return findings[i].Count > findings[j].Count
+	})
+	return findings
+}
+
+// Ошибка, если есть запросы с threshold и более повторами
+func (t *QueryTracker) Err(threshold int) error {
+	findings := t.Findings(threshold)
+	if len(findings) == 0 {
+		return nil
+	}
+
+	var b strings.Builder
+	writeFindings(&b, findings)
+	return fmt.Errorf("%w в %s:\n%s", ErrNPlusOne, t.Name, b.String())
+}
+
+func (t *QueryTracker) Report(w io.Writer) {
+	findings := t.Findings(2)
+	fmt.Fprintf(w, "%s: запросов %d, повторяющихся %d\n", t.Name, t.Total(), len(findings))
+	writeFindings(w, findings)
+}
+
+func writeFindings(w io.Writer, findings []NPlusOneFinding) {
+	for _, finding := range findings {
+		fmt.Fprintf(w, "  %d x %s\n", finding.Count, finding.SQL)
+		for _, site := range finding.CallSites {
+			fmt.Fprintf(w, "      %s\n", site)
+		}
+	}
+}
+
+// Счетчик запросов на каждый HTTP-запрос; отчет - если есть N+1
+func detectNPlusOne(threshold int, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, tracker := TrackQueries(r.Context(), r.Method+" "+r.URL.Path)
+		next.ServeHTTP(w, r.WithContext(ctx))
+
+		if len(tracker.Findings(threshold)) > 0 {
+			tracker.Report(os.Stderr)
+		}
+	})
+}
+
+func exampleNPlusOne(db *gorm.DB) {
+	db.Use(NPlusOneDetector{Threshold: 5})
+
+	// Посты каждого пользователя отдельным запросом - N+1
+	ctx, tracker := TrackQueries(db.Statement.Context, "posts in loop")
+	var users []User
+	db.WithContext(ctx).Find(&users)
+	for _, user := range users {
+		var posts []Post
+		db.WithContext(ctx).Where("user_id = ?", user.ID).Find(&posts)
+	}
+	tracker.Report(os.Stdout)
+
+	// С Preload - два запроса
+	ctx, tracker = TrackQueries(db.Statement.Context, "preload")
+	db.WithContext(ctx).Preload("Posts").Find(&users)
+	tracker.Report(os.Stdout)
+}
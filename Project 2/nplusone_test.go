@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestNPlusOneLoop(t *testing.T) {
+	db := openTestDB(t, &User{}, &Post{}, &OutboxEvent{}) // User пишет событие в outbox (outbox.go)
+	for i := 1; i <= 6; i++ {
+		user := User{Name: fmt.Sprint("user ", i), Email: fmt.Sprintf("user%d@example.com", i),
+			Posts: []Post{{Title: "first"}, {Title: "second"}}}
+		if err := db.Create(&user).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Use(NPlusOneDetector{Threshold: 5}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Посты каждого пользователя отдельным запросом
+	ctx, tracker := TrackQueries(context.Background(), "loop")
+	var users []User
+	db.WithContext(ctx).Find(&users)
+	for _, user := range users {
+		var posts []Post
+		db.WithContext(ctx).Where("user_id = ?", user.ID).Find(&posts)
+	}
+
+	err := tracker.Err(5)
+	if !errors.Is(err, ErrNPlusOne) {
+		t.Fatalf("N+1 не найден, запросов %d", tracker.Total())
+	}
+	findings := tracker.Findings(5)
+	if len(findings) != 1 || findings[0].Count != 6 || !strings.Contains(findings[0].SQL, "user_id = ?") {
+		t.Fatalf("findings = %+v", findings)
+	}
+	if !strings.Contains(findings[0].CallSites[0], "nplusone_test.go") {
+		t.Errorf("место вызова %s, а не цикл в тесте", findings[0].CallSites[0])
+	}
+
+	// С Preload - запрос пользователей и один IN (...) для постов
+	ctx, tracker = TrackQueries(context.Background(), "preload")
+	if err := db.WithContext(ctx).Preload("Posts").Find(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := tracker.Err(5); err != nil {
+		t.Fatal(err)
+	}
+	if tracker.Total() != 2 {
+		t.Errorf("с Preload запросов %d, ожидалось 2", tracker.Total())
+	}
+	if len(users) != 6 || len(users[0].Posts) != 2 {
+		t.Errorf("Preload загрузил %d пользователей, постов у первого %d", len(users), len(users[0].Posts))
+	}
+}
+
+func TestNPlusOneStrict(t *testing.T) {
+	db := openTestDB(t, &Post{})
+	if err := db.Use(NPlusOneDetector{Threshold: 3, Strict: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, _ := TrackQueries(context.Background(), "strict")
+	for i := 1; i <= 3; i++ {
+		var posts []Post
+		err := db.WithContext(ctx).Where("user_id = ?", i).Find(&posts).Error
+		if i < 3 && err != nil {
+			t.Fatalf("запрос %d: %v", i, err)
+		}
+		if i == 3 && !errors.Is(err, ErrNPlusOne) {
+			t.Fatalf("третий повтор не завершился ErrNPlusOne: %v", err)
+		}
+	}
+
+	// Без TrackQueries запросы не считаются
+	for i := 0; i < 5; i++ {
+		if err := db.Find(&[]Post{}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
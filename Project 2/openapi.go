@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"gorm.io/gorm/schema"
+)
+
+// Схемы моделей API (генератор - schemagen.go). База не нужна,
+// поэтому команда выполняется до подключения к ней:
+//
+//	go run . openapi > openapi.json
+//	go run . openapi -format=jsonschema -o schema.json
+
+var apiModels = []interface{}{
+	&User{},
+	&UserAddress{},
+	&UserCompany{},
+	&Post{},
+	&Comment{},
+}
+
+func openAPICommand(args []string) error {
+	flags := flag.NewFlagSet("openapi", flag.ExitOnError)
+	format := flags.String("format", "openapi", "openapi или jsonschema")
+	output := flags.String("o", "", "файл (по умолчанию - stdout)")
+	flags.Parse(args)
+	if *format != "openapi" && *format != "jsonschema" {
+		return errors.New("формат должен быть openapi или jsonschema")
+	}
+
+	// Имена таблиц и столбцов - как у gorm.Config по умолчанию в main
+	generator := newSchemaGenerator(schema.NamingStrategy{}, *format == "openapi")
+	for _, model := range apiModels {
+		if err := generator.add(model); err != nil {
+			return err
+		}
+	}
+
+	document := generator.openAPIDocument("jsonplaceholder")
+	if *format == "jsonschema" {
+		document = generator.jsonSchemaDocument("jsonplaceholder")
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(document); err != nil {
+		return err
+	}
+
+	if *output != "" {
+		fmt.Println("Схема записана в", *output)
+	}
+	return nil
+}
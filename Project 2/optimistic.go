@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// Оптимистическая блокировка: модель с полем типа Version при обновлении
+// получает условие WHERE version = <текущая версия> и version = версия + 1.
+// Если запись успели изменить (0 строк обновлено) - ошибка ErrConflict.
+//
+//	Version Version `gorm:"not null;default:1"`
+//
+// Файл общий с Project 1 и Project 4: там optimistic.go - ссылка на этот файл.
+
+var ErrConflict = errors.New("запись была изменена другим запросом")
+
+// Новые записи получают версию 1 (значение по умолчанию в базе)
+type Version int64
+
+var versionType = reflect.TypeOf(Version(0))
+
+const optimisticLockKey = "optimistic_lock:version"
+
+type OptimisticLockPlugin struct{}
+
+func (OptimisticLockPlugin) Name() string {
+	return "optimistic_lock"
+}
+
+func (p OptimisticLockPlugin) Initialize(db *gorm.DB) error {
+	if err := db.Callback().Update().Before("gorm:update").Register("optimistic_lock:before", p.before); err != nil {
+		return err
+	}
+	return db.Callback().Update().After("gorm:update").Register("optimistic_lock:after", p.after)
+}
+
+func versionField(s *schema.Schema) *schema.Field {
+	if s == nil {
+		return nil
+	}
+	for _, field := range s.Fields {
+		if field.FieldType == versionType && field.DBName != "" {
+			return field
+		}
+	}
+	return nil
+}
+
+func (OptimisticLockPlugin) before(db *gorm.DB) {
+	field := versionField(db.Statement.Schema)
+	if field == nil || db.Statement.ReflectValue.Kind() != reflect.Struct {
+		return
+	}
+
+	value, zero := field.ValueOf(db.Statement.Context, db.Statement.ReflectValue)
+	if zero {
+		// Версия неизвестна (Model(&T{}).Where(...)) - только увеличиваем
+		if dest, ok := db.Statement.Dest.(map[string]interface{}); ok {
+			dest[field.DBName] = gorm.Expr(db.Statement.Quote(field.DBName) + " + 1")
+		}
+		return
+	}
+
+	current := value.(Version)
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: current},
+	}})
+	db.Statement.SetColumn(field.DBName, current+1, true)
+	db.InstanceSet(optimisticLockKey, current)
+}
+
+func (OptimisticLockPlugin) after(db *gorm.DB) {
+	value, ok := db.InstanceGet(optimisticLockKey)
+	if !ok || db.Error != nil || db.RowsAffected > 0 {
+		return
+	}
+
+	// Ничего не обновлено: версия в базе уже другая (или запись удалена).
+	// Возвращаем прежнюю версию в модель.
+	field := versionField(db.Statement.Schema)
+	field.Set(db.Statement.Context, db.Statement.ReflectValue, value)
+	db.AddError(ErrConflict)
+}
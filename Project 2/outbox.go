@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Transactional outbox: событие пишется в таблицу outbox_events
+// в той же транзакции, что и изменение модели, а фоновый relay
+// доставляет его в sink. Доставка "хотя бы один раз": событие помечается
+// доставленным только после успешной отправки, при ошибке - повтор с паузой,
+// после MaxAttempts попыток - в dead letter (status = dead).
+
+const (
+	OutboxPending   = "pending"
+	OutboxDelivered = "delivered"
+	OutboxDead      = "dead"
+)
+
+type OutboxEvent struct {
+	ID            uint   `gorm:"primaryKey"`
+	Topic         string // например "user.created"
+	Payload       string // JSON
+	Status        string `gorm:"index;default:pending"`
+	Attempts      int
+	LastError     string
+	NextAttemptAt time.Time `gorm:"index"`
+	CreatedAt     time.Time
+	DeliveredAt   *time.Time
+}
+
+// Запись события в рамках транзакции tx
+func enqueueEvent(tx *gorm.DB, topic string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	return tx.Create(&OutboxEvent{
+		Topic:         topic,
+		Payload:       string(data),
+		Status:        OutboxPending,
+		NextAttemptAt: time.Now(),
+	}).Error
+}
+
+// Create выполняется в транзакции, поэтому событие и пользователь
+// сохраняются вместе или не сохраняются вовсе. Поэтому таблица outbox_events
+// должна существовать там, где создаются пользователи: без нее (нет миграции
+// OutboxEvent - autoMigrate, тесты) любой Create пользователя завершится ошибкой.
+func (u *User) AfterCreate(tx *gorm.DB) error {
+	return enqueueEvent(tx, "user.created", map[string]interface{}{
+		"id":       u.ID,
+		"name":     u.Name,
+		"username": u.Username,
+		"email":    u.Email,
+	})
+}
+
+type OutboxSink interface {
+	Deliver(ctx context.Context, event OutboxEvent) error
+}
+
+type StdoutSink struct{}
+
+func (StdoutSink) Deliver(ctx context.Context, event OutboxEvent) error {
+	fmt.Printf("event #%d %s: %s\n", event.ID, event.Topic, event.Payload)
+	return nil
+}
+
+// События дописываются в файл построчно (NDJSON)
+type FileSink struct {
+	Path string
+	mu   sync.Mutex
+}
+
+func (s *FileSink) Deliver(ctx context.Context, event OutboxEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.OpenFile(s.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return json.NewEncoder(file).Encode(event)
+}
+
+// POST JSON на URL; ответ не 2xx - ошибка доставки
+type WebhookSink struct {
+	URL    string
+	Client *http.Client
+}
+
+func (s WebhookSink) Deliver(ctx context.Context, event OutboxEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// Получатель может отбрасывать повторы по этому ключу
+	req.Header.Set("Idempotency-Key", fmt.Sprint(event.ID))
+
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook ответил %s", resp.Status)
+	}
+	return nil
+}
+
+type OutboxRelay struct {
+	DB          *gorm.DB
+	Sink        OutboxSink
+	BatchSize   int
+	MaxAttempts int
+	Interval    time.Duration
+}
+
+func NewOutboxRelay(db *gorm.DB, sink OutboxSink) *OutboxRelay {
+	return &OutboxRelay{
+		DB:          db,
+		Sink:        sink,
+		BatchSize:   100,
+		MaxAttempts: 5,
+		Interval:    time.Second,
+	}
+}
+
+func (r *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		// Пока есть события - обрабатываем без паузы
+		for {
+			count, err := r.relayBatch(ctx)
+			if err != nil {
+				fmt.Println("Ошибка outbox:", err)
+			}
+			if err != nil || count < r.BatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Одна пачка событий в транзакции. На Postgres строки блокируются
+// с SKIP LOCKED, поэтому несколько relay не доставят одно событие дважды.
+func (r *OutboxRelay) relayBatch(ctx context.Context) (int, error) {
+	count := 0
+
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		query := tx.Where("status = ? AND next_attempt_at <= ?", OutboxPending, time.Now()).
+			Order("id").
+			Limit(r.BatchSize)
+		if tx.Dialector.Name() == "postgres" {
+			query = query.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+		}
+
+		var events []OutboxEvent
+		if err := query.Find(&events).Error; err != nil {
+			return err
+		}
+		count = len(events)
+
+		for _, event := range events {
+			updates := r.deliver(ctx, event)
+			if err := tx.Model(&OutboxEvent{}).Where("id = ?", event.ID).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return count, err
+}
+
+// Изменения события после попытки доставки
+func (r *OutboxRelay) deliver(ctx context.Context, event OutboxEvent) map[string]interface{} {
+	err := r.Sink.Deliver(ctx, event)
+	if err == nil {
+		return map[string]interface{}{
+			"status":       OutboxDelivered,
+			"attempts":     event.Attempts + 1,
+			"delivered_at": time.Now(),
+			"last_error":   "",
+		}
+	}
+
+	attempts := event.Attempts + 1
+	status := OutboxPending
+	if attempts >= r.MaxAttempts {
+		status = OutboxDead
+	}
+
+	// Пауза растет экспоненциально: 2, 4, 8... секунд
+	backoff := time.Duration(1<<attempts) * time.Second
+
+	return map[string]interface{}{
+		"status":          status,
+		"attempts":        attempts,
+		"last_error":      err.Error(),
+		"next_attempt_at": time.Now().Add(backoff),
+	}
+}
+
+// Повторная отправка событий из dead letter
+func requeueDeadEvents(db *gorm.DB) (int64, error) {
+	result := db.Model(&OutboxEvent{}).
+		Where("status = ?", OutboxDead).
+		Updates(map[string]interface{}{
+			"status":          OutboxPending,
+			"attempts":        0,
+			"next_attempt_at": time.Now(),
+		})
+	return result.RowsAffected, result.Error
+}
+
+// Локальная заглушка webhook: печатает полученные события
+func serveWebhookStub(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		var event OutboxEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fmt.Printf("webhook: event #%d %s: %s\n", event.ID, event.Topic, event.Payload)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	fmt.Printf("Webhook заглушка на http://localhost%s/events\n", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		panic("Не удалось запустить webhook заглушку")
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Sink, который отвечает ошибками из списка, затем - успехом
+type scriptedSink struct {
+	errs      []error
+	delivered []OutboxEvent
+}
+
+func (s *scriptedSink) Deliver(ctx context.Context, event OutboxEvent) error {
+	s.delivered = append(s.delivered, event)
+	if len(s.errs) == 0 {
+		return nil
+	}
+	err := s.errs[0]
+	s.errs = s.errs[1:]
+	return err
+}
+
+func TestUserCreateEnqueuesEvent(t *testing.T) {
+	db := openTestDB(t, &User{}, &OutboxEvent{})
+	user := User{Name: "Bret", Username: "Bret", Email: "bret@example.com"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var event OutboxEvent
+	if err := db.First(&event).Error; err != nil {
+		t.Fatal(err)
+	}
+	var payload map[string]interface{}
+	json.Unmarshal([]byte(event.Payload), &payload)
+	if event.Topic != "user.created" || event.Status != OutboxPending || payload["email"] != user.Email {
+		t.Errorf("событие %+v", event)
+	}
+
+	// Без таблицы outbox_events пользователь не сохраняется (AfterCreate)
+	bare := openTestDB(t, &User{})
+	if err := bare.Create(&User{Name: "Bret", Email: "bret@example.com"}).Error; err == nil {
+		t.Error("пользователь создан без outbox_events")
+	}
+	var count int64
+	bare.Model(&User{}).Count(&count)
+	if count != 0 {
+		t.Errorf("пользователей без события: %d", count)
+	}
+}
+
+func TestOutboxRelayRetry(t *testing.T) {
+	db := openTestDB(t, &OutboxEvent{})
+	if err := enqueueEvent(db, "test", map[string]int{"n": 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	failure := errors.New("sink недоступен")
+	sink := &scriptedSink{errs: []error{failure, failure, failure}}
+	relay := NewOutboxRelay(db, sink)
+	relay.MaxAttempts = 3
+	ctx := context.Background()
+
+	load := func() OutboxEvent {
+		t.Helper()
+		var event OutboxEvent
+		if err := db.First(&event).Error; err != nil {
+			t.Fatal(err)
+		}
+		return event
+	}
+	// Время повтора наступило
+	due := func() {
+		db.Model(&OutboxEvent{}).Where("1 = 1").Update("next_attempt_at", time.Now().Add(-time.Second))
+	}
+
+	// Неудача: повтор через 2 секунды, затем через 4
+	for i, backoff := range []time.Duration{2 * time.Second, 4 * time.Second} {
+		before := time.Now()
+		if _, err := relay.relayBatch(ctx); err != nil {
+			t.Fatal(err)
+		}
+		event := load()
+		if event.Status != OutboxPending || event.Attempts != i+1 || event.LastError != failure.Error() {
+			t.Fatalf("попытка %d: %+v", i+1, event)
+		}
+		if wait := event.NextAttemptAt.Sub(before); wait < backoff || wait > backoff+time.Second {
+			t.Errorf("попытка %d: повтор через %v, ожидалось %v", i+1, wait, backoff)
+		}
+
+		// До времени повтора событие не отправляется
+		if count, _ := relay.relayBatch(ctx); count != 0 || len(sink.delivered) != i+1 {
+			t.Errorf("попытка %d: отправлено до времени повтора", i+1)
+		}
+		due()
+	}
+
+	// После MaxAttempts неудач - dead letter, relay его больше не берет
+	relay.relayBatch(ctx)
+	if event := load(); event.Status != OutboxDead || event.Attempts != 3 {
+		t.Fatalf("после %d попыток: %+v", relay.MaxAttempts, event)
+	}
+	due()
+	if count, _ := relay.relayBatch(ctx); count != 0 {
+		t.Error("dead letter отправлен повторно")
+	}
+
+	// Возврат из dead letter и успешная доставка
+	if n, err := requeueDeadEvents(db); err != nil || n != 1 {
+		t.Fatalf("requeue: %d, %v", n, err)
+	}
+	relay.relayBatch(ctx)
+	event := load()
+	if event.Status != OutboxDelivered || event.Attempts != 1 || event.LastError != "" || event.DeliveredAt == nil {
+		t.Errorf("после requeue: %+v", event)
+	}
+	if len(sink.delivered) != 4 {
+		t.Errorf("попыток доставки %d", len(sink.delivered))
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	var keys []string
+	status := http.StatusInternalServerError
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	db := openTestDB(t, &OutboxEvent{})
+	enqueueEvent(db, "test", "payload")
+	relay := NewOutboxRelay(db, WebhookSink{URL: server.URL})
+	ctx := context.Background()
+
+	// Ответ 500 - ошибка доставки
+	relay.relayBatch(ctx)
+	var event OutboxEvent
+	db.First(&event)
+	if event.Status != OutboxPending || event.LastError == "" {
+		t.Fatalf("после 500: %+v", event)
+	}
+
+	status = http.StatusNoContent
+	db.Model(&OutboxEvent{}).Where("1 = 1").Update("next_attempt_at", time.Now().Add(-time.Second))
+	relay.relayBatch(ctx)
+	db.First(&event)
+	if event.Status != OutboxDelivered {
+		t.Errorf("после 204: %+v", event)
+	}
+
+	// Повтор приходит с тем же ключом идемпотентности
+	if len(keys) != 2 || keys[0] != keys[1] || keys[0] != "1" {
+		t.Errorf("Idempotency-Key: %v", keys)
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+// Маршрутизация запросов: чтение (Find, Scan, Raw SELECT) уходит на реплики,
+// запись и транзакции - на основную базу (это делает dbresolver).
+// ReplicaPolicy выбирает реплику и возвращает основную базу,
+// если ни одна реплика не отвечает.
+
+type ReplicaMode int
+
+const (
+	RoundRobin   ReplicaMode = iota // по очереди
+	LeastLatency                    // реплика с наименьшим временем ответа
+)
+
+type replicaState struct {
+	healthy bool
+	latency time.Duration
+}
+
+type ReplicaPolicy struct {
+	Mode    ReplicaMode
+	primary gorm.ConnPool
+
+	mu     sync.RWMutex
+	states map[gorm.ConnPool]*replicaState
+	next   uint64
+}
+
+func NewReplicaPolicy(primary gorm.ConnPool, mode ReplicaMode) *ReplicaPolicy {
+	return &ReplicaPolicy{
+		Mode:    mode,
+		primary: primary,
+		states:  map[gorm.ConnPool]*replicaState{},
+	}
+}
+
+func (p *ReplicaPolicy) Resolve(connPools []gorm.ConnPool) gorm.ConnPool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Новые реплики считаются здоровыми до первой проверки
+	var healthy []gorm.ConnPool
+	for _, pool := range connPools {
+		state, ok := p.states[pool]
+		if !ok {
+			state = &replicaState{healthy: true}
+			p.states[pool] = state
+		}
+		if state.healthy {
+			healthy = append(healthy, pool)
+		}
+	}
+
+	if len(healthy) == 0 {
+		return p.primary
+	}
+
+	if p.Mode == LeastLatency {
+		best := healthy[0]
+		for _, pool := range healthy[1:] {
+			if p.states[pool].latency < p.states[best].latency {
+				best = pool
+			}
+		}
+		return best
+	}
+
+	p.next++
+	return healthy[p.next%uint64(len(healthy))]
+}
+
+// Периодически пингует реплики и запоминает их состояние и задержку
+func (p *ReplicaPolicy) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.checkReplicas(ctx)
+		}
+	}
+}
+
+func (p *ReplicaPolicy) checkReplicas(ctx context.Context) {
+	p.mu.RLock()
+	pools := make([]gorm.ConnPool, 0, len(p.states))
+	for pool := range p.states {
+		pools = append(pools, pool)
+	}
+	p.mu.RUnlock()
+
+	for _, pool := range pools {
+		pinger, ok := pool.(interface{ PingContext(context.Context) error })
+		if !ok {
+			continue
+		}
+
+		pingCtx, cancel := context.WithTimeout(ctx, time.Second)
+		start := time.Now()
+		err := pinger.PingContext(pingCtx)
+		latency := time.Since(start)
+		cancel()
+
+		p.mu.Lock()
+		p.states[pool].healthy = err == nil
+		p.states[pool].latency = latency
+		p.mu.Unlock()
+	}
+}
+
+// Подключение реплик к db
+func useReplicas(db *gorm.DB, mode ReplicaMode, replicaDSNs ...string) (*ReplicaPolicy, error) {
+	var replicas []gorm.Dialector
+	for _, dsn := range replicaDSNs {
+		replicas = append(replicas, postgres.Open(dsn))
+	}
+	return registerReplicas(db, mode, replicas)
+}
+
+// То же для готовых диалектов (в тестах - реплики на SQLite)
+func registerReplicas(db *gorm.DB, mode ReplicaMode, replicas []gorm.Dialector) (*ReplicaPolicy, error) {
+	policy := NewReplicaPolicy(db.ConnPool, mode)
+	resolver := dbresolver.Register(dbresolver.Config{
+		Replicas: replicas,
+		Policy:   policy,
+	})
+	if err := db.Use(resolver); err != nil {
+		return nil, err
+	}
+
+	if err := registerReadYourWrites(db); err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+// Read-your-writes: после записи в рамках запроса (контекста)
+// последующие чтения идут на основную базу, а не на отстающую реплику.
+
+type readYourWritesKey struct{}
+
+type readYourWrites struct {
+	wrote atomic.Bool
+}
+
+func withReadYourWrites(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readYourWritesKey{}, &readYourWrites{})
+}
+
+func readYourWritesFrom(db *gorm.DB) *readYourWrites {
+	if db.Statement.Context == nil {
+		return nil
+	}
+	state, _ := db.Statement.Context.Value(readYourWritesKey{}).(*readYourWrites)
+	return state
+}
+
+func registerReadYourWrites(db *gorm.DB) error {
+	markWrite := func(db *gorm.DB) {
+		if state := readYourWritesFrom(db); state != nil && db.Error == nil {
+			state.wrote.Store(true)
+		}
+	}
+
+	// Выполняется после gorm:db_resolver: Write.ModifyStatement
+	// повторно выбирает соединение, теперь уже основное
+	usePrimary := func(db *gorm.DB) {
+		if state := readYourWritesFrom(db); state != nil && state.wrote.Load() {
+			dbresolver.Write.ModifyStatement(db.Statement)
+		}
+	}
+
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Create().After("gorm:create").Register("replicas:mark_write", markWrite),
+		cb.Update().After("gorm:update").Register("replicas:mark_write", markWrite),
+		cb.Delete().After("gorm:delete").Register("replicas:mark_write", markWrite),
+		cb.Raw().After("gorm:raw").Register("replicas:mark_write", markWrite),
+		cb.Query().Before("gorm:query").Register("replicas:use_primary", usePrimary),
+		cb.Row().Before("gorm:row").Register("replicas:use_primary", usePrimary),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Пример: отчеты читаются с реплик, а после записи в том же контексте - с основной базы
+func exampleReplicas(db *gorm.DB) {
+	ctx := withReadYourWrites(db.Statement.Context)
+
+	GetPostCountByUser(db.WithContext(ctx)) // реплика
+
+	db.WithContext(ctx).Create(&Post{UserID: 1, Title: "title", Body: "body"})
+
+	GetPostCountByUser(db.WithContext(ctx)) // основная база
+
+	fmt.Println("Отчеты выполнены.")
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func openTestPools(t *testing.T, n int) []gorm.ConnPool {
+	t.Helper()
+	pools := make([]gorm.ConnPool, n)
+	for i := range pools {
+		sqlDB, err := openTestDB(t).DB()
+		if err != nil {
+			t.Fatal(err)
+		}
+		pools[i] = sqlDB
+	}
+	return pools
+}
+
+func TestReplicaRoundRobin(t *testing.T) {
+	pools := openTestPools(t, 4)
+	primary, replicas := pools[0], pools[1:]
+	policy := NewReplicaPolicy(primary, RoundRobin)
+
+	// Каждая реплика - по одному разу за круг
+	seen := map[gorm.ConnPool]int{}
+	for i := 0; i < 2*len(replicas); i++ {
+		seen[policy.Resolve(replicas)]++
+	}
+	for i, replica := range replicas {
+		if seen[replica] != 2 {
+			t.Errorf("реплика %d выбрана %d раз, ожидалось 2", i, seen[replica])
+		}
+	}
+
+	// Недоступная реплика пропускается
+	replicas[0].(*sql.DB).Close()
+	policy.checkReplicas(context.Background())
+	for i := 0; i < 4; i++ {
+		if pool := policy.Resolve(replicas); pool == replicas[0] || pool == primary {
+			t.Fatalf("выбрана недоступная реплика или основная база")
+		}
+	}
+}
+
+func TestReplicaLeastLatency(t *testing.T) {
+	pools := openTestPools(t, 4)
+	primary, replicas := pools[0], pools[1:]
+	policy := NewReplicaPolicy(primary, LeastLatency)
+	policy.Resolve(replicas)
+
+	// Задержки задаются напрямую: измеренные checkReplicas на SQLite почти равны
+	for i, latency := range []time.Duration{30 * time.Millisecond, 10 * time.Millisecond, 20 * time.Millisecond} {
+		policy.states[replicas[i]].latency = latency
+	}
+	for i := 0; i < 3; i++ {
+		if pool := policy.Resolve(replicas); pool != replicas[1] {
+			t.Fatalf("выбрана не самая быстрая реплика")
+		}
+	}
+
+	policy.states[replicas[1]].healthy = false
+	if pool := policy.Resolve(replicas); pool != replicas[2] {
+		t.Errorf("после отказа быстрой реплики выбрана не следующая по задержке")
+	}
+}
+
+func TestReplicaFallbackToPrimary(t *testing.T) {
+	pools := openTestPools(t, 3)
+	primary, replicas := pools[0], pools[1:]
+
+	for _, mode := range []ReplicaMode{RoundRobin, LeastLatency} {
+		policy := NewReplicaPolicy(primary, mode)
+		policy.Resolve(replicas)
+		for _, replica := range replicas {
+			replica.(*sql.DB).Close()
+		}
+		policy.checkReplicas(context.Background())
+
+		if pool := policy.Resolve(replicas); pool != primary {
+			t.Errorf("режим %d: все реплики недоступны, но выбрана не основная база", mode)
+		}
+	}
+}
+
+type replicaTestNote struct {
+	ID   uint `gorm:"primaryKey"`
+	Text string
+}
+
+func TestReadYourWrites(t *testing.T) {
+	db := openTestDB(t, &replicaTestNote{})
+
+	// Реплика - отдельная база с одной записью, отставшая от основной
+	replicaPath := filepath.Join(t.TempDir(), "replica.db")
+	replica, err := gorm.Open(sqlite.Open(replicaPath), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := replica.AutoMigrate(&replicaTestNote{}); err != nil {
+		t.Fatal(err)
+	}
+	replica.Create(&replicaTestNote{Text: "replica"})
+	if sqlDB, err := replica.DB(); err == nil {
+		sqlDB.Close()
+	}
+
+	if _, err := registerReplicas(db, RoundRobin, []gorm.Dialector{sqlite.Open(replicaPath)}); err != nil {
+		t.Fatal(err)
+	}
+
+	texts := func(db *gorm.DB) []string {
+		var notes []replicaTestNote
+		if err := db.Order("id").Find(&notes).Error; err != nil {
+			t.Fatal(err)
+		}
+		var result []string
+		for _, note := range notes {
+			result = append(result, note.Text)
+		}
+		return result
+	}
+	rawText := func(db *gorm.DB) string {
+		var text string
+		db.Raw("SELECT text FROM replica_test_notes ORDER BY id LIMIT 1").Scan(&text)
+		return text
+	}
+
+	ctx := withReadYourWrites(context.Background())
+	if got := texts(db.WithContext(ctx)); len(got) != 1 || got[0] != "replica" {
+		t.Fatalf("до записи чтение не с реплики: %v", got)
+	}
+
+	if err := db.WithContext(ctx).Create(&replicaTestNote{Text: "primary"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// В том же контексте - основная база, и для Find, и для Raw
+	if got := texts(db.WithContext(ctx)); len(got) != 1 || got[0] != "primary" {
+		t.Errorf("после записи чтение не с основной базы: %v", got)
+	}
+	if got := rawText(db.WithContext(ctx)); got != "primary" {
+		t.Errorf("Raw после записи: %q", got)
+	}
+
+	// В другом контексте - снова реплика
+	if got := texts(db.WithContext(withReadYourWrites(context.Background()))); len(got) != 1 || got[0] != "replica" {
+		t.Errorf("новый контекст читает не с реплики: %v", got)
+	}
+	if got := rawText(db); got != "replica" {
+		t.Errorf("Raw без контекста: %q", got)
+	}
+}
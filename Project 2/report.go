@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+type UserEngagement struct {
+	UserID             uint    `gorm:"column:user_id" json:"user_id"`
+	Name               string  `json:"name"`
+	Email              string  `json:"email"`
+	PostCount          int     `json:"post_count"`
+	CommentsReceived   int     `json:"comments_received"` // комментарии к постам пользователя
+	CommentsWritten    int     `json:"comments_written"`  // комментарии, оставленные с email пользователя
+	AvgCommentsPerPost float64 `json:"avg_comments_per_post"`
+	Percentile         float64 `json:"percentile"` // место по полученным комментариям, 0..1
+}
+
+type EngagementSummary struct {
+	Users                  int     `json:"users"`
+	AvgPosts               float64 `json:"avg_posts"`
+	AvgCommentsReceived    float64 `json:"avg_comments_received"`
+	AvgCommentsWritten     float64 `json:"avg_comments_written"`
+	MedianCommentsReceived float64 `json:"median_comments_received"`
+	P90CommentsReceived    float64 `json:"p90_comments_received"`
+}
+
+type EngagementReport struct {
+	Summary EngagementSummary `json:"summary"`
+	Users   []UserEngagement  `json:"users"`
+}
+
+// Все показатели считаются одним запросом:
+// посты и полученные комментарии - из posts + comments,
+// написанные комментарии - по совпадению email (как в FindMatchingEmails).
+// Raw-запрос плагин арендаторов не видит: users фильтруются условием
+// TenantCondition, остальные таблицы соединяются по tenant_id (tenancy.go).
+const engagementQuery = `
+	WITH post_stats AS (
+		SELECT posts.tenant_id, posts.user_id, COUNT(DISTINCT posts.id) as post_count, COUNT(comments.id) as comments_received
+		FROM posts
+		LEFT JOIN comments ON comments.post_id = posts.id AND comments.tenant_id = posts.tenant_id
+		GROUP BY posts.tenant_id, posts.user_id
+	), written AS (
+		SELECT tenant_id, LOWER(email) as email, COUNT(*) as comments_written
+		FROM comments
+		GROUP BY tenant_id, LOWER(email)
+	)
+	SELECT users.id as user_id, users.name, users.email,
+		COALESCE(post_stats.post_count, 0) as post_count,
+		COALESCE(post_stats.comments_received, 0) as comments_received,
+		COALESCE(written.comments_written, 0) as comments_written,
+		COALESCE(CAST(post_stats.comments_received AS FLOAT) / NULLIF(post_stats.post_count, 0), 0) as avg_comments_per_post,
+		PERCENT_RANK() OVER (ORDER BY COALESCE(post_stats.comments_received, 0)) as percentile
+	FROM users
+	LEFT JOIN post_stats ON post_stats.user_id = users.id AND post_stats.tenant_id = users.tenant_id
+	LEFT JOIN written ON written.email = LOWER(users.email) AND written.tenant_id = users.tenant_id
+	WHERE ?
+	ORDER BY users.id
+`
+
+func GetUserEngagementReport(db *gorm.DB) EngagementReport {
+	var report EngagementReport
+
+	tenant, err := TenantCondition(db, "users")
+	if err != nil {
+		fmt.Println("Ошибка:", err)
+		return report
+	}
+
+	db.Raw(engagementQuery, tenant).Scan(&report.Users)
+	report.Summary = summarizeEngagement(report.Users)
+
+	for _, user := range report.Users {
+		fmt.Printf("user.id: %d\n", user.UserID)
+		fmt.Printf("user.name: %s\n", user.Name)
+		fmt.Printf("post_count: %d\n", user.PostCount)
+		fmt.Printf("comments_received: %d\n", user.CommentsReceived)
+		fmt.Printf("comments_written: %d\n", user.CommentsWritten)
+		fmt.Printf("avg_comments_per_post: %.2f\n", user.AvgCommentsPerPost)
+		fmt.Printf("percentile: %.2f\n", user.Percentile)
+		fmt.Println("-------------")
+	}
+
+	return report
+}
+
+// Средние и процентили по уже полученным строкам, без повторных запросов
+func summarizeEngagement(users []UserEngagement) EngagementSummary {
+	summary := EngagementSummary{Users: len(users)}
+	if len(users) == 0 {
+		return summary
+	}
+
+	received := make([]float64, 0, len(users))
+	for _, user := range users {
+		summary.AvgPosts += float64(user.PostCount)
+		summary.AvgCommentsReceived += float64(user.CommentsReceived)
+		summary.AvgCommentsWritten += float64(user.CommentsWritten)
+		received = append(received, float64(user.CommentsReceived))
+	}
+
+	n := float64(len(users))
+	summary.AvgPosts /= n
+	summary.AvgCommentsReceived /= n
+	summary.AvgCommentsWritten /= n
+
+	sort.Float64s(received)
+	summary.MedianCommentsReceived = percentile(received, 0.5)
+	summary.P90CommentsReceived = percentile(received, 0.9)
+
+	return summary
+}
+
+// Процентиль с линейной интерполяцией (как PERCENTILE_CONT), values отсортированы
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	pos := p * float64(len(values)-1)
+	lower := int(math.Floor(pos))
+	upper := int(math.Ceil(pos))
+
+	return values[lower] + (values[upper]-values[lower])*(pos-float64(lower))
+}
+
+func writeEngagementCSV(w io.Writer, report EngagementReport) error {
+	writer := csv.NewWriter(w)
+
+	writer.Write([]string{"user_id", "name", "email", "post_count", "comments_received", "comments_written", "avg_comments_per_post", "percentile"})
+	for _, user := range report.Users {
+		writer.Write([]string{
+			strconv.FormatUint(uint64(user.UserID), 10),
+			user.Name,
+			user.Email,
+			strconv.Itoa(user.PostCount),
+			strconv.Itoa(user.CommentsReceived),
+			strconv.Itoa(user.CommentsWritten),
+			strconv.FormatFloat(user.AvgCommentsPerPost, 'f', 2, 64),
+			strconv.FormatFloat(user.Percentile, 'f', 2, 64),
+		})
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func writeEngagementJSON(w io.Writer, report EngagementReport) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+var engagementTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<title>Активность пользователей</title>
+	<style>
+		table { border-collapse: collapse; }
+		th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: right; }
+		td:nth-child(2), td:nth-child(3) { text-align: left; }
+	</style>
+</head>
+<body>
+	<h1>Активность пользователей</h1>
+	<p>
+		Пользователей: {{.Summary.Users}},
+		в среднем постов: {{printf "%.2f" .Summary.AvgPosts}},
+		полученных комментариев: {{printf "%.2f" .Summary.AvgCommentsReceived}}
+		(медиана {{printf "%.0f" .Summary.MedianCommentsReceived}}, p90 {{printf "%.0f" .Summary.P90CommentsReceived}}),
+		написанных комментариев: {{printf "%.2f" .Summary.AvgCommentsWritten}}
+	</p>
+	<table>
+		<tr>
+			<th>ID</th><th>Name</th><th>Email</th><th>Posts</th>
+			<th>Comments received</th><th>Comments written</th>
+			<th>Avg per post</th><th>Percentile</th>
+		</tr>
+		{{range .Users}}
+		<tr>
+			<td>{{.UserID}}</td><td>{{.Name}}</td><td>{{.Email}}</td><td>{{.PostCount}}</td>
+			<td>{{.CommentsReceived}}</td><td>{{.CommentsWritten}}</td>
+			<td>{{printf "%.2f" .AvgCommentsPerPost}}</td><td>{{printf "%.2f" .Percentile}}</td>
+		</tr>
+		{{end}}
+	</table>
+</body>
+</html>
+`))
+
+func writeEngagementHTML(w io.Writer, report EngagementReport) error {
+	return engagementTemplate.Execute(w, report)
+}
+
+// Сохраняет отчет в dir в виде report.csv, report.json и report.html
+func exportEngagementReport(report EngagementReport, dir string) error {
+	writers := map[string]func(io.Writer, EngagementReport) error{
+		"report.csv":  writeEngagementCSV,
+		"report.json": writeEngagementJSON,
+		"report.html": writeEngagementHTML,
+	}
+
+	for name, write := range writers {
+		file, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+
+		err = write(file, report)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Println("Отчет сохранен в", dir)
+	return nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// go test -run TestEngagementGolden -update - перезаписать testdata/report.*
+var updateGolden = flag.Bool("update", false, "перезаписать эталонные файлы в testdata")
+
+// Имена с запятой, кавычками и HTML - для проверки экранирования
+func testEngagementReport() EngagementReport {
+	users := []UserEngagement{
+		{UserID: 1, Name: "Leanne Graham", Email: "Sincere@april.biz", PostCount: 2, CommentsReceived: 5, CommentsWritten: 1, AvgCommentsPerPost: 2.5, Percentile: 1},
+		{UserID: 2, Name: `Ervin "Antonette", Jr.`, Email: "Shanna@melissa.tv", PostCount: 3, CommentsReceived: 2, AvgCommentsPerPost: 2.0 / 3, Percentile: 0.5},
+		{UserID: 3, Name: "<script>alert('x')</script>", Email: "a&b@example.com", CommentsWritten: 4},
+	}
+	return EngagementReport{Summary: summarizeEngagement(users), Users: users}
+}
+
+func TestEngagementGolden(t *testing.T) {
+	report := testEngagementReport()
+
+	for name, write := range map[string]func(io.Writer, EngagementReport) error{
+		"report.csv":  writeEngagementCSV,
+		"report.json": writeEngagementJSON,
+	} {
+		var buf bytes.Buffer
+		if err := write(&buf, report); err != nil {
+			t.Fatal(err)
+		}
+
+		golden := filepath.Join("testdata", name)
+		if *updateGolden {
+			if err := os.WriteFile(golden, buf.Bytes(), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want, err := os.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), want) {
+			t.Errorf("%s отличается от эталона:\n%s\nожидалось:\n%s", name, buf.Bytes(), want)
+		}
+	}
+}
+
+func TestEngagementHTMLEscaping(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeEngagementHTML(&buf, testEngagementReport()); err != nil {
+		t.Fatal(err)
+	}
+	html := buf.String()
+
+	for _, raw := range []string{"<script>", "a&b@example.com", `"Antonette"`} {
+		if strings.Contains(html, raw) {
+			t.Errorf("не экранировано: %s", raw)
+		}
+	}
+	for _, escaped := range []string{"&lt;script&gt;alert(&#39;x&#39;)&lt;/script&gt;", "a&amp;b@example.com", "Ervin &#34;Antonette&#34;, Jr."} {
+		if !strings.Contains(html, escaped) {
+			t.Errorf("нет %s", escaped)
+		}
+	}
+
+	// Сводка: 3 пользователя, медиана полученных комментариев 2, p90 4.4 (в HTML - без дробной части)
+	for _, summary := range []string{"Пользователей: 3", "медиана 2", "p90 4", "<td>0.67</td>"} {
+		if !strings.Contains(html, summary) {
+			t.Errorf("нет %q", summary)
+		}
+	}
+}
+
+func TestExportEngagementReport(t *testing.T) {
+	dir := t.TempDir()
+	if err := exportEngagementReport(testEngagementReport(), dir); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"report.csv", "report.json"} {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s отличается от эталона", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "report.html")); err != nil {
+		t.Error(err)
+	}
+}
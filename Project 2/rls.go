@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// Row-level security в Postgres: читать posts и comments может любой,
+// а изменять пост - только его автор (posts.user_id) или администратор
+// (user_credentials.role = 'admin', auth.go), комментарии к посту - тоже.
+// Проверку делает сама база, поэтому она действует и для db.Raw/db.Exec.
+// Правило записано в функции app_can_edit_post (ее используют политики);
+// API (auth.go) проверяет то же правило в Go, чтобы ответить 403 и в SQLite.
+//
+// Текущий пользователь задается на транзакцию (AsUser):
+//   SET LOCAL ROLE jsonplaceholder_app            - роль без обхода RLS
+//   SELECT app_set_current_user(<id>)             - один раз за транзакцию
+//
+// Почему не SET LOCAL app.current_user_id и current_setting в политиках:
+// настройку может поменять любой запрос той же транзакции -
+// db.Exec("SET LOCAL app.current_user_id = '2'") или set_config(...)
+// через db.Raw, - и политики поверили бы ему. Это ровно тот обход через
+// db.Raw, от которого RLS должна защищать. Поэтому пользователь хранится
+// в таблице rls_current_user, к которой у роли нет доступа: пишет в нее
+// только функция SECURITY DEFINER, и повторный вызов в той же транзакции -
+// ошибка. Смена app.current_user_id на политики не влияет - это проверяют
+// go run . rls check и rls_test.go.
+//
+// Суперпользователь и владелец таблицы RLS не подчиняются (FORCE касается
+// только владельца), поэтому запросы выполняются от отдельной роли.
+// Приложение надо подключать под этой ролью (или другой без SUPERUSER
+// и BYPASSRLS): иначе db.Exec("RESET ROLE") внутри транзакции вернет
+// права суперпользователя. Тест rls_test.go подключается именно так.
+
+const rlsRole = "jsonplaceholder_app"
+
+var rlsMigration = []string{
+	`DO $$ BEGIN
+		IF NOT EXISTS (SELECT FROM pg_roles WHERE rolname = '` + rlsRole + `') THEN
+			CREATE ROLE ` + rlsRole + ` NOLOGIN;
+		END IF;
+	END $$`,
+	`GRANT ` + rlsRole + ` TO CURRENT_USER`,
+	`GRANT USAGE ON SCHEMA public TO ` + rlsRole,
+	`GRANT SELECT, INSERT, UPDATE, DELETE ON ALL TABLES IN SCHEMA public TO ` + rlsRole,
+	`GRANT USAGE, SELECT ON ALL SEQUENCES IN SCHEMA public TO ` + rlsRole,
+
+	// Пользователь текущей транзакции: строка на соединение (backend_pid),
+	// действует только в транзакции, которая ее записала
+	`CREATE TABLE IF NOT EXISTS rls_current_user (
+		backend_pid integer PRIMARY KEY,
+		xact_id bigint NOT NULL,
+		user_id bigint NOT NULL
+	)`,
+	`REVOKE ALL ON rls_current_user FROM PUBLIC, ` + rlsRole,
+
+	// Пользователь не задан - NULL, под политики не подходит
+	`CREATE OR REPLACE FUNCTION app_current_user_id() RETURNS bigint AS $$
+		SELECT user_id FROM rls_current_user
+		WHERE backend_pid = pg_backend_pid() AND xact_id = txid_current_if_assigned()
+	$$ LANGUAGE sql STABLE SECURITY DEFINER SET search_path = public`,
+	`CREATE OR REPLACE FUNCTION app_set_current_user(uid bigint) RETURNS void AS $$
+	BEGIN
+		IF app_current_user_id() IS NOT NULL THEN
+			RAISE EXCEPTION 'пользователь транзакции уже задан';
+		END IF;
+		INSERT INTO rls_current_user (backend_pid, xact_id, user_id)
+		VALUES (pg_backend_pid(), txid_current(), uid)
+		ON CONFLICT (backend_pid) DO UPDATE SET xact_id = EXCLUDED.xact_id, user_id = EXCLUDED.user_id;
+	END
+	$$ LANGUAGE plpgsql SECURITY DEFINER SET search_path = public`,
+
+	`CREATE OR REPLACE FUNCTION app_current_user_is_admin() RETURNS boolean AS $$
+		SELECT EXISTS (SELECT 1 FROM user_credentials WHERE user_id = app_current_user_id() AND role = '` + RoleAdmin + `')
+	$$ LANGUAGE sql STABLE SECURITY DEFINER SET search_path = public`,
+	// Пост (и комментарии к нему) может менять автор или администратор
+	`CREATE OR REPLACE FUNCTION app_can_edit_post(pid bigint) RETURNS boolean AS $$
+		SELECT app_current_user_is_admin()
+			OR EXISTS (SELECT 1 FROM posts WHERE id = pid AND user_id = app_current_user_id())
+	$$ LANGUAGE sql STABLE SECURITY DEFINER SET search_path = public`,
+
+	`ALTER TABLE posts ENABLE ROW LEVEL SECURITY`,
+	`ALTER TABLE posts FORCE ROW LEVEL SECURITY`,
+	`DROP POLICY IF EXISTS posts_select ON posts`,
+	`DROP POLICY IF EXISTS posts_insert ON posts`,
+	`DROP POLICY IF EXISTS posts_update ON posts`,
+	`DROP POLICY IF EXISTS posts_delete ON posts`,
+	`CREATE POLICY posts_select ON posts FOR SELECT USING (true)`,
+	`CREATE POLICY posts_insert ON posts FOR INSERT
+		WITH CHECK (user_id = app_current_user_id() OR app_current_user_is_admin())`,
+	// WITH CHECK не дает автору передать свой пост другому пользователю
+	`CREATE POLICY posts_update ON posts FOR UPDATE
+		USING (app_can_edit_post(id))
+		WITH CHECK (user_id = app_current_user_id() OR app_current_user_is_admin())`,
+	`CREATE POLICY posts_delete ON posts FOR DELETE USING (app_can_edit_post(id))`,
+
+	`ALTER TABLE comments ENABLE ROW LEVEL SECURITY`,
+	`ALTER TABLE comments FORCE ROW LEVEL SECURITY`,
+	`DROP POLICY IF EXISTS comments_select ON comments`,
+	`DROP POLICY IF EXISTS comments_insert ON comments`,
+	`DROP POLICY IF EXISTS comments_update ON comments`,
+	`DROP POLICY IF EXISTS comments_delete ON comments`,
+	`CREATE POLICY comments_select ON comments FOR SELECT USING (true)`,
+	`CREATE POLICY comments_insert ON comments FOR INSERT WITH CHECK (app_current_user_id() IS NOT NULL)`,
+	`CREATE POLICY comments_update ON comments FOR UPDATE
+		USING (app_can_edit_post(post_id))
+		WITH CHECK (app_can_edit_post(post_id))`,
+	`CREATE POLICY comments_delete ON comments FOR DELETE USING (app_can_edit_post(post_id))`,
+}
+
+var ErrRLSUnsupported = errors.New("row-level security есть только в Postgres")
+
+// Миграция: роль, функции и политики (повторный запуск безопасен).
+// Роли пользователей (user_credentials) нужны функциям уже при создании.
+func installRowLevelSecurity(db *gorm.DB) error {
+	if db.Dialector.Name() != "postgres" {
+		return ErrRLSUnsupported
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.AutoMigrate(&UserCredential{}); err != nil {
+			return err
+		}
+		for _, statement := range rlsMigration {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Запросы fn выполняются от имени пользователя userID.
+// Изменение чужих строк затрагивает 0 строк (UPDATE/DELETE)
+// или завершается ошибкой политики (INSERT, смена user_id).
+func AsUser(ctx context.Context, db *gorm.DB, userID uint, fn func(tx *gorm.DB) error) error {
+	if db.Dialector.Name() != "postgres" {
+		return ErrRLSUnsupported
+	}
+
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SET LOCAL ROLE " + rlsRole).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("SELECT app_set_current_user(?)", userID).Error; err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+}
+
+// go run . rls install - миграция
+// go run . rls check   - попытки обойти политики; код выхода 1, если какая-то удалась
+func rlsCommand(db *gorm.DB, args []string) error {
+	if len(args) == 0 {
+		return errors.New("использование: rls install | rls check")
+	}
+
+	switch args[0] {
+	case "install":
+		if err := installRowLevelSecurity(db); err != nil {
+			return err
+		}
+		fmt.Println("Политики RLS для posts и comments установлены.")
+		return nil
+	case "check":
+		return checkRowLevelSecurity(db)
+	default:
+		return fmt.Errorf("неизвестная подкоманда rls %s", args[0])
+	}
+}
+
+// Отмена транзакции после проверки: данные не меняются
+var errRollback = errors.New("rollback")
+
+type rlsAttempt struct {
+	name string
+	// true - попытка заблокирована
+	run func(tx *gorm.DB) (bool, error)
+}
+
+func checkRowLevelSecurity(db *gorm.DB) error {
+	// Два автора с постами (не администраторы): от имени первого
+	// пытаемся менять посты второго
+	var authors []uint
+	db.Model(&Post{}).
+		Where("user_id NOT IN (SELECT user_id FROM user_credentials WHERE role = ?)", RoleAdmin).
+		Distinct("user_id").Order("user_id").Limit(2).Pluck("user_id", &authors)
+	if len(authors) < 2 {
+		return errors.New("нужны посты как минимум двух пользователей")
+	}
+	me, other := authors[0], authors[1]
+
+	var myPost, otherPost Post
+	db.Where("user_id = ?", me).First(&myPost)
+	db.Where("user_id = ?", other).First(&otherPost)
+
+	var bypass bool
+	db.Raw("SELECT rolsuper OR rolbypassrls FROM pg_roles WHERE rolname = session_user").Scan(&bypass)
+	if bypass {
+		fmt.Println("Подключение под ролью с SUPERUSER или BYPASSRLS: RESET ROLE снимает политики")
+	}
+
+	attempts := []rlsAttempt{
+		{"Raw UPDATE чужого поста", func(tx *gorm.DB) (bool, error) {
+			result := tx.Exec("UPDATE posts SET title = 'rls' WHERE id = ?", otherPost.ID)
+			return result.RowsAffected == 0, result.Error
+		}},
+		{"Raw UPDATE всех постов меняет только свои", func(tx *gorm.DB) (bool, error) {
+			var mine int64
+			tx.Raw("SELECT COUNT(*) FROM posts WHERE user_id = ?", me).Scan(&mine)
+			result := tx.Exec("UPDATE posts SET title = title")
+			return result.RowsAffected == mine, result.Error
+		}},
+		{"Raw SELECT ... FOR UPDATE чужого поста", func(tx *gorm.DB) (bool, error) {
+			var ids []uint
+			err := tx.Raw("SELECT id FROM posts WHERE id = ? FOR UPDATE", otherPost.ID).Scan(&ids).Error
+			return len(ids) == 0, err
+		}},
+		{"Передача своего поста другому пользователю", func(tx *gorm.DB) (bool, error) {
+			err := tx.Exec("UPDATE posts SET user_id = ? WHERE id = ?", other, myPost.ID).Error
+			return err != nil, nil
+		}},
+		{"INSERT поста от имени другого пользователя", func(tx *gorm.DB) (bool, error) {
+			err := tx.Exec("INSERT INTO posts (user_id, title, body, version) VALUES (?, 'rls', 'rls', 1)", other).Error
+			return err != nil, nil
+		}},
+		{"Raw DELETE комментариев к чужому посту", func(tx *gorm.DB) (bool, error) {
+			result := tx.Exec("DELETE FROM comments WHERE post_id = ?", otherPost.ID)
+			return result.RowsAffected == 0, result.Error
+		}},
+		{"GORM Update чужого поста", func(tx *gorm.DB) (bool, error) {
+			result := tx.Model(&Post{ID: otherPost.ID}).Update("title", "rls")
+			return result.RowsAffected == 0, result.Error
+		}},
+		{"GORM Delete чужого поста", func(tx *gorm.DB) (bool, error) {
+			result := tx.Delete(&Post{}, otherPost.ID)
+			return result.RowsAffected == 0, result.Error
+		}},
+		{"set_config('app.current_user_id') не меняет пользователя", func(tx *gorm.DB) (bool, error) {
+			tx.Exec("SELECT set_config('app.current_user_id', ?, true)", fmt.Sprint(other))
+			result := tx.Exec("UPDATE posts SET title = 'rls' WHERE id = ?", otherPost.ID)
+			return result.RowsAffected == 0, result.Error
+		}},
+		{"SET LOCAL app.current_user_id не меняет пользователя", func(tx *gorm.DB) (bool, error) {
+			tx.Exec(fmt.Sprintf("SET LOCAL app.current_user_id = '%d'", other))
+			result := tx.Exec("UPDATE posts SET title = 'rls' WHERE id = ?", otherPost.ID)
+			return result.RowsAffected == 0, result.Error
+		}},
+		{"Повторный app_set_current_user", func(tx *gorm.DB) (bool, error) {
+			err := tx.Exec("SELECT app_set_current_user(?)", other).Error
+			return err != nil, nil
+		}},
+		{"Запись в rls_current_user", func(tx *gorm.DB) (bool, error) {
+			err := tx.Exec("UPDATE rls_current_user SET user_id = ?", other).Error
+			return err != nil, nil
+		}},
+		{"RESET ROLE и UPDATE чужого поста", func(tx *gorm.DB) (bool, error) {
+			if err := tx.Exec("RESET ROLE").Error; err != nil {
+				return false, err
+			}
+			result := tx.Exec("UPDATE posts SET title = 'rls' WHERE id = ?", otherPost.ID)
+			return result.RowsAffected == 0, result.Error
+		}},
+		{"Свой пост изменить можно", func(tx *gorm.DB) (bool, error) {
+			result := tx.Exec("UPDATE posts SET title = 'rls' WHERE id = ?", myPost.ID)
+			return result.RowsAffected == 1, result.Error
+		}},
+	}
+
+	failed := 0
+	for _, attempt := range attempts {
+		var ok bool
+		err := AsUser(db.Statement.Context, db, me, func(tx *gorm.DB) error {
+			var err error
+			ok, err = attempt.run(tx)
+			if err != nil {
+				return err
+			}
+			return errRollback
+		})
+		if err != nil && !errors.Is(err, errRollback) {
+			fmt.Printf("FAIL %s: %v\n", attempt.name, err)
+			failed++
+			continue
+		}
+		if !ok {
+			fmt.Printf("FAIL %s\n", attempt.name)
+			failed++
+			continue
+		}
+		fmt.Printf("ok   %s\n", attempt.name)
+	}
+
+	// Без пользователя изменить нельзя ничего
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SET LOCAL ROLE " + rlsRole).Error; err != nil {
+			return err
+		}
+		result := tx.Exec("UPDATE posts SET title = title")
+		if result.Error == nil && result.RowsAffected == 0 {
+			fmt.Println("ok   UPDATE без AsUser")
+		} else {
+			fmt.Println("FAIL UPDATE без AsUser")
+			failed++
+		}
+		return errRollback
+	})
+	if err != nil && !errors.Is(err, errRollback) {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("проверок не пройдено: %d", failed)
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const rlsTestPassword = "rls_test"
+
+// Миграция и данные - от TEST_POSTGRES_DSN (владелец таблиц),
+// запросы приложения - от роли jsonplaceholder_app с правом входа:
+// под суперпользователем RESET ROLE снимает политики
+func openRLSTestDB(t *testing.T) (admin, app *gorm.DB) {
+	t.Helper()
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN не задан")
+	}
+
+	admin, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := admin.AutoMigrate(&User{}, &Post{}, &Comment{}, &OutboxEvent{}, &UserCredential{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := admin.Exec("TRUNCATE users, posts, comments, user_credentials RESTART IDENTITY CASCADE").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := installRowLevelSecurity(admin); err != nil {
+		t.Fatal(err)
+	}
+	if err := admin.Exec("ALTER ROLE " + rlsRole + " LOGIN PASSWORD '" + rlsTestPassword + "'").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.User = rlsRole
+	config.Password = rlsTestPassword
+	sqlDB := stdlib.OpenDB(*config)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	app, err = gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return admin, app
+}
+
+func TestRowLevelSecurity(t *testing.T) {
+	admin, app := openRLSTestDB(t)
+
+	var users []User
+	for i := 1; i <= 2; i++ {
+		user := User{Name: fmt.Sprint("rls ", i), Email: fmt.Sprintf("rls%d@example.com", i),
+			Posts: []Post{{Title: fmt.Sprint("post ", i), Body: "rls", Comments: []Comment{{Body: "rls"}}}}}
+		if err := admin.Create(&user).Error; err != nil {
+			t.Fatal(err)
+		}
+		users = append(users, user)
+	}
+	me, other := users[0].ID, users[1].ID
+	myPost, otherPost := users[0].Posts[0], users[1].Posts[0]
+
+	asMe := func(t *testing.T, fn func(tx *gorm.DB) error) error {
+		t.Helper()
+		err := AsUser(context.Background(), app, me, func(tx *gorm.DB) error {
+			if err := fn(tx); err != nil {
+				return err
+			}
+			return errRollback
+		})
+		if errors.Is(err, errRollback) {
+			return nil
+		}
+		return err
+	}
+
+	// Запрос в транзакции AsUser должен затронуть want строк
+	affects := func(t *testing.T, want int64, tricks []string, sql string, vars ...interface{}) {
+		t.Helper()
+		err := asMe(t, func(tx *gorm.DB) error {
+			for _, trick := range tricks {
+				if err := tx.Exec(trick).Error; err != nil {
+					return err
+				}
+			}
+			result := tx.Exec(sql, vars...)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected != want {
+				t.Errorf("%s: затронуто строк %d, ожидалось %d", sql, result.RowsAffected, want)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	setOther := fmt.Sprintf("SELECT set_config('app.current_user_id', '%d', true)", other)
+	setLocalOther := fmt.Sprintf("SET LOCAL app.current_user_id = '%d'", other)
+
+	t.Run("UPDATE чужого поста", func(t *testing.T) {
+		affects(t, 0, nil, "UPDATE posts SET title = 'rls' WHERE id = ?", otherPost.ID)
+	})
+	t.Run("DELETE чужого поста", func(t *testing.T) {
+		affects(t, 0, nil, "DELETE FROM posts WHERE id = ?", otherPost.ID)
+	})
+	t.Run("DELETE комментариев к чужому посту", func(t *testing.T) {
+		affects(t, 0, nil, "DELETE FROM comments WHERE post_id = ?", otherPost.ID)
+	})
+	t.Run("UPDATE своего поста", func(t *testing.T) {
+		affects(t, 1, nil, "UPDATE posts SET title = 'rls' WHERE id = ?", myPost.ID)
+	})
+
+	t.Run("set_config", func(t *testing.T) {
+		affects(t, 0, []string{setOther}, "UPDATE posts SET title = 'rls' WHERE id = ?", otherPost.ID)
+		affects(t, 0, []string{setOther}, "DELETE FROM posts WHERE id = ?", otherPost.ID)
+		affects(t, 0, []string{setLocalOther}, "UPDATE posts SET title = 'rls' WHERE id = ?", otherPost.ID)
+	})
+	t.Run("RESET ROLE", func(t *testing.T) {
+		affects(t, 0, []string{"RESET ROLE"}, "UPDATE posts SET title = 'rls' WHERE id = ?", otherPost.ID)
+		affects(t, 0, []string{"RESET ROLE", setOther}, "DELETE FROM posts WHERE id = ?", otherPost.ID)
+	})
+
+	t.Run("повторный app_set_current_user", func(t *testing.T) {
+		err := asMe(t, func(tx *gorm.DB) error {
+			return tx.Exec("SELECT app_set_current_user(?)", other).Error
+		})
+		if err == nil {
+			t.Error("пользователя транзакции удалось сменить")
+		}
+	})
+	t.Run("запись в rls_current_user", func(t *testing.T) {
+		err := asMe(t, func(tx *gorm.DB) error {
+			return tx.Exec("UPDATE rls_current_user SET user_id = ?", other).Error
+		})
+		if err == nil {
+			t.Error("у роли приложения есть доступ к rls_current_user")
+		}
+	})
+
+	t.Run("authorizePost", func(t *testing.T) {
+		for _, tc := range []struct {
+			postID uint
+			want   error
+		}{
+			{myPost.ID, nil},
+			{otherPost.ID, ErrForbidden},
+			{999999, gorm.ErrRecordNotFound},
+		} {
+			err := asMe(t, func(tx *gorm.DB) error { return authorizePost(tx, Principal{UserID: me, Role: RoleUser}, tc.postID) })
+			if !errors.Is(err, tc.want) {
+				t.Errorf("пост %d: %v, ожидалось %v", tc.postID, err, tc.want)
+			}
+		}
+	})
+
+	t.Run("администратор", func(t *testing.T) {
+		root := User{Name: "rls admin", Email: "rls-admin@example.com"}
+		if err := admin.Create(&root).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := setPassword(admin, root.ID, "admin password", RoleAdmin); err != nil {
+			t.Fatal(err)
+		}
+
+		err := AsUser(context.Background(), app, root.ID, func(tx *gorm.DB) error {
+			if err := authorizePost(tx, Principal{UserID: root.ID, Role: RoleAdmin}, otherPost.ID); err != nil {
+				return err
+			}
+			result := tx.Exec("UPDATE comments SET body = body WHERE post_id = ?", otherPost.ID)
+			if result.Error == nil && result.RowsAffected != 1 {
+				t.Errorf("администратор изменил комментариев к чужому посту: %d", result.RowsAffected)
+			}
+			return errRollback
+		})
+		if !errors.Is(err, errRollback) {
+			t.Error(err)
+		}
+	})
+
+	t.Run("без AsUser", func(t *testing.T) {
+		result := app.Exec("UPDATE posts SET title = 'rls'")
+		if result.Error != nil || result.RowsAffected != 0 {
+			t.Errorf("без пользователя затронуто строк %d: %v", result.RowsAffected, result.Error)
+		}
+	})
+
+	var count int64
+	admin.Model(&Post{}).Where("id = ? AND title = ?", otherPost.ID, otherPost.Title).Count(&count)
+	if count != 1 {
+		t.Error("чужой пост изменен или удален")
+	}
+}
+
+func TestAsUserSQLite(t *testing.T) {
+	err := AsUser(context.Background(), openTestDB(t), 1, func(tx *gorm.DB) error { return nil })
+	if !errors.Is(err, ErrRLSUnsupported) {
+		t.Errorf("AsUser на SQLite: %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// Сверка моделей со схемой базы (schemadiff.go). AutoMigrate только
+// добавляет столбцы и индексы, а удаленные поля, смену типа или NOT NULL
+// не переносит, поэтому база со временем расходится с моделями:
+//
+//	go run . schema check
+//
+// Расхождения выводятся по таблицам, при наличии хотя бы одного
+// команда завершается с ненулевым кодом (для проверки перед выкладкой).
+
+// Модели, которые создает autoMigrate
+var schemaModels = []interface{}{
+	&User{},
+	&UserAddress{},
+	&UserCompany{},
+	&Post{},
+	&Comment{},
+	&OutboxEvent{},
+	&UserCredential{},
+	&AuthSession{},
+}
+
+func schemaCommand(db *gorm.DB, args []string) error {
+	if len(args) == 0 || args[0] != "check" {
+		return errors.New("использование: schema check")
+	}
+
+	diffs, err := checkSchema(db, schemaModels)
+	if err != nil {
+		return err
+	}
+	if len(diffs) == 0 {
+		fmt.Println("Схема базы совпадает с моделями.")
+		return nil
+	}
+
+	printSchemaDiffs(diffs)
+	return fmt.Errorf("схема базы расходится с моделями: %d различий", len(diffs))
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Сверка моделей со схемой базы (introspect.go): столбцы, типы, NULL,
+// индексы и внешние ключи.
+//
+//	+ есть в модели, нет в базе
+//	- есть в базе, нет в модели
+//	~ есть и там и там, но отличается
+//
+// Файл общий с Project 4: там schemadiff.go и introspect.go - ссылки
+// на эти файлы, поэтому здесь только сверка, без моделей и команд Project 2.
+
+type SchemaDiff struct {
+	Table  string
+	Kind   string // "+", "-", "~"
+	Object string // "столбец email", "индекс idx_users_email"...
+	Detail string
+}
+
+func (d SchemaDiff) String() string {
+	if d.Detail == "" {
+		return fmt.Sprintf("%s %s", d.Kind, d.Object)
+	}
+	return fmt.Sprintf("%s %s: %s", d.Kind, d.Object, d.Detail)
+}
+
+// Вывод расхождений по таблицам
+func printSchemaDiffs(diffs []SchemaDiff) {
+	table := ""
+	for _, diff := range diffs {
+		if diff.Table != table {
+			table = diff.Table
+			fmt.Printf("%s:\n", table)
+		}
+		fmt.Println("  " + diff.String())
+	}
+}
+
+func checkSchema(db *gorm.DB, models []interface{}) ([]SchemaDiff, error) {
+	var diffs []SchemaDiff
+	constraints := map[string]*schema.Constraint{}
+
+	for _, model := range models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return nil, err
+		}
+		s := stmt.Schema
+
+		if !db.Migrator().HasTable(s.Table) {
+			diffs = append(diffs, SchemaDiff{Table: s.Table, Kind: "+", Object: "таблица " + s.Table})
+			continue
+		}
+		info, err := introspectTable(db, s.Table)
+		if err != nil {
+			return nil, err
+		}
+
+		diffs = append(diffs, compareColumns(db, s, info)...)
+		diffs = append(diffs, compareIndexes(s, info)...)
+
+		// Внешние ключи создаются в таблице со ссылкой - не обязательно в этой
+		for _, rel := range s.Relationships.Relations {
+			if constraint := rel.ParseConstraint(); constraint != nil {
+				constraints[constraint.Name] = constraint
+			}
+		}
+	}
+
+	if !db.DisableForeignKeyConstraintWhenMigrating {
+		fkDiffs, err := compareForeignKeys(db, constraints)
+		if err != nil {
+			return nil, err
+		}
+		diffs = append(diffs, fkDiffs...)
+	}
+
+	sort.SliceStable(diffs, func(i, j int) bool {
+		return diffs[i].Table < diffs[j].Table
+	})
+	return diffs, nil
+}
+
+func compareColumns(db *gorm.DB, s *schema.Schema, info TableInfo) []SchemaDiff {
+	var diffs []SchemaDiff
+	inModel := map[string]bool{}
+
+	for _, field := range s.Fields {
+		if field.DBName == "" || field.IgnoreMigration {
+			continue
+		}
+		inModel[field.DBName] = true
+		object := "столбец " + field.DBName
+
+		column, ok := info.Column(field.DBName)
+		if !ok {
+			diffs = append(diffs, SchemaDiff{Table: s.Table, Kind: "+", Object: object})
+			continue
+		}
+
+		expected := strings.ToLower(db.Dialector.DataTypeOf(field))
+		if typeFamily(expected) != typeFamily(column.Type) {
+			diffs = append(diffs, SchemaDiff{Table: s.Table, Kind: "~", Object: object,
+				Detail: fmt.Sprintf("тип %s в модели, %s в базе", expected, column.Type)})
+		} else if isTextType(column.Type) && field.Size > 0 && column.Length > 0 && int64(field.Size) != column.Length {
+			diffs = append(diffs, SchemaDiff{Table: s.Table, Kind: "~", Object: object,
+				Detail: fmt.Sprintf("размер %d в модели, %d в базе", field.Size, column.Length)})
+		}
+
+		if nullable := !field.NotNull && !field.PrimaryKey; !column.PrimaryKey && nullable != column.Nullable {
+			diffs = append(diffs, SchemaDiff{Table: s.Table, Kind: "~", Object: object,
+				Detail: fmt.Sprintf("%s в модели, %s в базе", nullability(nullable), nullability(column.Nullable))})
+		}
+
+		if field.Unique && !column.Unique {
+			diffs = append(diffs, SchemaDiff{Table: s.Table, Kind: "+", Object: object, Detail: "UNIQUE"})
+		}
+	}
+
+	for _, column := range info.Columns {
+		if !inModel[column.Name] {
+			diffs = append(diffs, SchemaDiff{Table: s.Table, Kind: "-", Object: "столбец " + column.Name,
+				Detail: column.Type})
+		}
+	}
+	return diffs
+}
+
+func nullability(nullable bool) string {
+	if nullable {
+		return "NULL"
+	}
+	return "NOT NULL"
+}
+
+var (
+	typeSize      = regexp.MustCompile(`\(.*\)`)
+	typeModifiers = regexp.MustCompile(`\s+(primary key|autoincrement|unsigned|generated .*)`)
+)
+
+// Синонимы типов: int8 и bigint, bigserial (автоинкремент) и bigint...
+// Регистр, размер и модификаторы (integer primary key autoincrement
+// в SQLite) отбрасываются.
+func typeFamily(typ string) string {
+	typ = typeModifiers.ReplaceAllString(strings.ToLower(typ), "")
+	typ = strings.TrimSpace(typeSize.ReplaceAllString(typ, ""))
+	switch typ {
+	case "int2", "smallint", "smallserial":
+		return "smallint"
+	case "int4", "int", "integer", "serial":
+		return "integer"
+	case "int8", "bigint", "bigserial":
+		return "bigint"
+	case "bool", "boolean":
+		return "boolean"
+	case "float4", "real":
+		return "real"
+	case "float8", "double precision", "double", "float":
+		return "double"
+	case "decimal", "numeric":
+		return "numeric"
+	case "varchar", "character varying":
+		return "varchar"
+	case "bpchar", "char", "character":
+		return "char"
+	case "timestamptz", "timestamp with time zone":
+		return "timestamptz"
+	case "timestamp", "timestamp without time zone":
+		return "timestamp"
+	}
+	return typ
+}
+
+func compareIndexes(s *schema.Schema, info TableInfo) []SchemaDiff {
+	var diffs []SchemaDiff
+	inDB := map[string]IndexInfo{}
+	for _, index := range info.Indexes {
+		inDB[index.Name] = index
+	}
+
+	for _, index := range s.ParseIndexes() {
+		var columns []string
+		for _, option := range index.Fields {
+			if option.Field != nil {
+				columns = append(columns, option.DBName)
+			}
+		}
+		unique := index.Class == "UNIQUE"
+		object := fmt.Sprintf("индекс %s (%s)", index.Name, strings.Join(columns, ", "))
+
+		existing, ok := inDB[index.Name]
+		switch {
+		case !ok:
+			diffs = append(diffs, SchemaDiff{Table: s.Table, Kind: "+", Object: object})
+		case existing.Unique != unique:
+			diffs = append(diffs, SchemaDiff{Table: s.Table, Kind: "~", Object: object,
+				Detail: fmt.Sprintf("уникальный: %t в модели, %t в базе", unique, existing.Unique)})
+		case strings.Join(existing.Columns, ",") != strings.Join(columns, ","):
+			diffs = append(diffs, SchemaDiff{Table: s.Table, Kind: "~", Object: object,
+				Detail: fmt.Sprintf("столбцы в базе (%s)", strings.Join(existing.Columns, ", "))})
+		}
+	}
+	return diffs
+}
+
+// Внешние ключи сравниваются по столбцу и таблице, на которую ссылаются:
+// в SQLite у ограничений нет имен
+func compareForeignKeys(db *gorm.DB, constraints map[string]*schema.Constraint) ([]SchemaDiff, error) {
+	tables := map[string]bool{}
+	for _, constraint := range constraints {
+		tables[constraint.Schema.Table] = true
+	}
+	var tableNames []string
+	for table := range tables {
+		if db.Migrator().HasTable(table) {
+			tableNames = append(tableNames, table)
+		}
+	}
+	foreignKeys, err := introspectForeignKeys(db, tableNames)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []SchemaDiff
+	for _, constraint := range constraints {
+		table := constraint.Schema.Table
+		if !db.Migrator().HasTable(table) || len(constraint.ForeignKeys) == 0 {
+			continue
+		}
+		column := constraint.ForeignKeys[0].DBName
+		refTable := constraint.ReferenceSchema.Table
+
+		found := false
+		for _, fk := range foreignKeys[table] {
+			if fk.Column == column && fk.RefTable == refTable {
+				found = true
+				break
+			}
+		}
+		if !found {
+			diffs = append(diffs, SchemaDiff{Table: table, Kind: "+",
+				Object: "внешний ключ " + constraint.Name,
+				Detail: fmt.Sprintf("%s -> %s(%s)", column, refTable, constraint.References[0].DBName)})
+		}
+	}
+
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Object < diffs[j].Object
+	})
+	return diffs, nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTypeFamily(t *testing.T) {
+	for _, synonyms := range [][]string{
+		{"bigint", "int8", "BIGSERIAL"},
+		{"integer", "int4", "serial", "integer primary key autoincrement"},
+		{"real", "float4"},
+		{"double precision", "float8", "double"},
+		{"numeric(10,2)", "decimal"},
+		{"varchar(32)", "character varying", "VARCHAR"},
+		{"char(2)", "bpchar", "character"},
+		{"timestamp", "timestamp without time zone"},
+		{"timestamptz", "TIMESTAMP WITH TIME ZONE"},
+	} {
+		for _, typ := range synonyms[1:] {
+			if typeFamily(typ) != typeFamily(synonyms[0]) {
+				t.Errorf("typeFamily(%q) = %q, typeFamily(%q) = %q", typ, typeFamily(typ), synonyms[0], typeFamily(synonyms[0]))
+			}
+		}
+	}
+	if typeFamily("timestamp") == typeFamily("timestamptz") {
+		t.Error("timestamp и timestamptz - разные типы")
+	}
+}
+
+func TestCheckSchema(t *testing.T) {
+	db := openTestDB(t, &User{}, &Post{}, &Comment{})
+	models := []interface{}{&User{}, &Post{}, &Comment{}}
+
+	diffs, err := checkSchema(db, models)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 0 {
+		t.Fatalf("после AutoMigrate: %v", diffs)
+	}
+
+	db.Exec("ALTER TABLE posts ADD COLUMN legacy text")
+	db.Exec("DROP INDEX idx_comments_post_id")
+
+	diffs, err = checkSchema(db, models)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, diff := range diffs {
+		got = append(got, diff.Table+" "+diff.String())
+	}
+	want := []string{
+		"comments + индекс idx_comments_post_id (post_id)",
+		"posts - столбец legacy: text",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("расхождения:\n%s\nожидалось:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm/schema"
+)
+
+// Схемы OpenAPI 3 и JSON Schema из моделей, разобранных GORM.
+// Свойства называются так же, как их кодирует encoding/json (имя поля
+// или тег json), поля встроенной структуры (gorm.Model) - на верхнем уровне,
+// а поле-структура с gorm:"embedded" - вложенным объектом.
+// Имя столбца в базе - в расширении x-gorm-column (с учетом embeddedPrefix).
+//
+// Файл общий с Project 4: там schemagen.go - ссылка на этот файл,
+// поэтому здесь только генератор, без моделей и команд Project 2.
+
+type jsonObject = map[string]interface{}
+
+type schemaGenerator struct {
+	namer     schema.Namer
+	openAPI   bool // false - JSON Schema 2020-12
+	refPrefix string
+	cache     *sync.Map
+	schemas   map[string]jsonObject
+}
+
+func newSchemaGenerator(namer schema.Namer, openAPI bool) *schemaGenerator {
+	g := &schemaGenerator{namer: namer, openAPI: openAPI, cache: &sync.Map{}, schemas: map[string]jsonObject{}}
+	g.refPrefix = "#/$defs/"
+	if openAPI {
+		g.refPrefix = "#/components/schemas/"
+	}
+	return g
+}
+
+func (g *schemaGenerator) add(model interface{}) error {
+	s, err := schema.Parse(model, g.cache, g.namer)
+	if err != nil {
+		return err
+	}
+	g.addSchema(s)
+	return nil
+}
+
+func (g *schemaGenerator) addSchema(s *schema.Schema) {
+	if _, ok := g.schemas[s.Name]; ok {
+		return
+	}
+
+	object := jsonObject{"type": "object", "properties": jsonObject{}}
+	g.schemas[s.Name] = object
+
+	for _, field := range s.Fields {
+		if field.DBName == "" {
+			continue
+		}
+		parent, name, ok := g.propertyPath(object, s.ModelType, field.BindNames)
+		if !ok {
+			continue
+		}
+
+		parent["properties"].(jsonObject)[name] = g.fieldSchema(field)
+		if field.PrimaryKey || (field.NotNull && !field.HasDefaultValue) || hasRule(field, "required") {
+			addRequired(parent, name)
+		}
+	}
+
+	// Связи: has one / belongs to - ссылка, has many / many2many - массив ссылок
+	names := make([]string, 0, len(s.Relationships.Relations))
+	for name := range s.Relationships.Relations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, relName := range names {
+		rel := s.Relationships.Relations[relName]
+		parent, name, ok := g.propertyPath(object, s.ModelType, rel.Field.BindNames)
+		if !ok {
+			continue
+		}
+
+		g.addSchema(rel.FieldSchema)
+		ref := jsonObject{"$ref": g.refPrefix + rel.FieldSchema.Name}
+		property := jsonObject{"type": "array", "items": ref}
+		if rel.Type != schema.HasMany && rel.Type != schema.Many2Many {
+			// В OpenAPI 3.0 соседние с $ref ключи игнорируются
+			property = ref
+			if g.openAPI {
+				property = jsonObject{"allOf": []jsonObject{ref}}
+			}
+		}
+		property["x-gorm-relation"] = string(rel.Type)
+		if len(rel.References) > 0 {
+			property["x-gorm-foreign-key"] = rel.References[0].ForeignKey.DBName
+		}
+		parent["properties"].(jsonObject)[name] = property
+	}
+}
+
+// Объект, в который попадает поле, и имя свойства. Поля анонимной встроенной
+// структуры поднимаются на уровень выше (как в encoding/json), поля
+// именованной структуры - вложенный объект.
+func (g *schemaGenerator) propertyPath(object jsonObject, modelType reflect.Type, bindNames []string) (jsonObject, string, bool) {
+	current, t := object, modelType
+	for i, bindName := range bindNames {
+		structField, ok := t.FieldByName(bindName)
+		if !ok {
+			return nil, "", false
+		}
+
+		name, skip := jsonFieldName(structField)
+		if skip {
+			return nil, "", false
+		}
+		if i == len(bindNames)-1 {
+			return current, name, true
+		}
+
+		t = structField.Type
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if structField.Anonymous && structField.Tag.Get("json") == "" {
+			continue
+		}
+
+		properties := current["properties"].(jsonObject)
+		nested, ok := properties[name].(jsonObject)
+		if !ok {
+			nested = jsonObject{"type": "object", "properties": jsonObject{}}
+			properties[name] = nested
+		}
+		current = nested
+	}
+	return nil, "", false
+}
+
+func jsonFieldName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", true
+	}
+	if name, _, _ := strings.Cut(tag, ","); name != "" {
+		return name, false
+	}
+	return field.Name, false
+}
+
+func addRequired(object jsonObject, name string) {
+	required, _ := object["required"].([]string)
+	object["required"] = append(required, name)
+}
+
+func (g *schemaGenerator) fieldSchema(field *schema.Field) jsonObject {
+	property := jsonObject{}
+
+	var typ string
+	switch field.DataType {
+	case schema.Bool:
+		typ = "boolean"
+	case schema.Int, schema.Uint:
+		typ = "integer"
+		property["format"] = "int64"
+		if field.Size > 0 && field.Size <= 32 {
+			property["format"] = "int32"
+		}
+		if field.DataType == schema.Uint {
+			property["minimum"] = 0
+		}
+	case schema.Float:
+		typ = "number"
+	case schema.Time:
+		typ = "string"
+		property["format"] = "date-time"
+	case schema.Bytes:
+		typ = "string"
+		property["format"] = "byte"
+	default:
+		typ = "string"
+		if field.Size > 0 {
+			property["maxLength"] = field.Size
+		}
+	}
+
+	if isNullable(field) {
+		if g.openAPI {
+			property["nullable"] = true
+		} else {
+			property["type"] = []string{typ, "null"}
+		}
+	}
+	if property["type"] == nil {
+		property["type"] = typ
+	}
+
+	// Правила validate (validation.go)
+	for _, rule := range strings.Split(field.Tag.Get("validate"), ",") {
+		name, arg, _ := strings.Cut(rule, "=")
+		n, _ := strconv.Atoi(arg)
+		switch {
+		case name == "email":
+			property["format"] = "email"
+		case name == "url":
+			property["format"] = "uri"
+		case name == "max" && typ == "string":
+			property["maxLength"] = n
+		case name == "min" && typ == "string":
+			property["minLength"] = n
+		}
+	}
+
+	if field.PrimaryKey {
+		property["x-gorm-primary-key"] = true
+	}
+	if (field.PrimaryKey && field.AutoIncrement) || field.AutoCreateTime > 0 || field.AutoUpdateTime > 0 {
+		property["readOnly"] = true
+	}
+	if field.HasDefaultValue && field.DefaultValueInterface != nil {
+		property["default"] = field.DefaultValueInterface
+	}
+	property["x-gorm-column"] = field.DBName
+
+	return property
+}
+
+// NULL допустим для указателей, sql.Null* и gorm.DeletedAt
+func isNullable(field *schema.Field) bool {
+	if field.PrimaryKey || field.NotNull {
+		return false
+	}
+	if field.IndirectFieldType != field.FieldType {
+		return true
+	}
+	name := field.FieldType.Name()
+	return strings.HasPrefix(name, "Null") || name == "DeletedAt"
+}
+
+func hasRule(field *schema.Field, rule string) bool {
+	for _, r := range strings.Split(field.Tag.Get("validate"), ",") {
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *schemaGenerator) openAPIDocument(title string) jsonObject {
+	return jsonObject{
+		"openapi":    "3.0.3",
+		"info":       jsonObject{"title": title, "version": "1.0.0"},
+		"paths":      jsonObject{},
+		"components": jsonObject{"schemas": g.schemas},
+	}
+}
+
+func (g *schemaGenerator) jsonSchemaDocument(title string) jsonObject {
+	return jsonObject{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"title":   title,
+		"$defs":   g.schemas,
+	}
+}
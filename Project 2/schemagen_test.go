@@ -0,0 +1,107 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Как Blog2 в Project 4 (blog.go), но на основе gorm.Model
+type schemaTestAuthor struct {
+	Name  string
+	Email string
+}
+
+type schemaTestBlog struct {
+	gorm.Model
+	Author  schemaTestAuthor `gorm:"embedded;embeddedPrefix:author_"`
+	Upvotes int32
+}
+
+func generateSchemas(t *testing.T, openAPI bool, models ...interface{}) map[string]jsonObject {
+	t.Helper()
+	generator := newSchemaGenerator(schema.NamingStrategy{}, openAPI)
+	for _, model := range models {
+		if err := generator.add(model); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return generator.schemas
+}
+
+func schemaProperty(t *testing.T, object jsonObject, path ...string) jsonObject {
+	t.Helper()
+	for _, name := range path {
+		property, ok := object["properties"].(jsonObject)[name].(jsonObject)
+		if !ok {
+			t.Fatalf("нет свойства %q в %v", name, object)
+		}
+		object = property
+	}
+	return object
+}
+
+func TestSchemaEmbedded(t *testing.T) {
+	blog := generateSchemas(t, true, &schemaTestBlog{})["schemaTestBlog"]
+
+	// Поля gorm.Model - на верхнем уровне, Author - вложенный объект
+	if id := schemaProperty(t, blog, "ID"); id["x-gorm-primary-key"] != true || id["readOnly"] != true {
+		t.Errorf("ID = %v", id)
+	}
+	for property, column := range map[string]string{"Name": "author_name", "Email": "author_email"} {
+		if got := schemaProperty(t, blog, "Author", property)["x-gorm-column"]; got != column {
+			t.Errorf("Author.%s: x-gorm-column = %v, ожидался %s", property, got, column)
+		}
+	}
+	if got := schemaProperty(t, blog, "Upvotes")["format"]; got != "int32" {
+		t.Errorf("Upvotes: format = %v", got)
+	}
+}
+
+func TestSchemaNullable(t *testing.T) {
+	blog := generateSchemas(t, true, &schemaTestBlog{})["schemaTestBlog"]
+	if deletedAt := schemaProperty(t, blog, "DeletedAt"); deletedAt["nullable"] != true || deletedAt["type"] != "string" {
+		t.Errorf("OpenAPI: DeletedAt = %v", deletedAt)
+	}
+	if createdAt := schemaProperty(t, blog, "CreatedAt"); createdAt["nullable"] != nil {
+		t.Errorf("OpenAPI: CreatedAt = %v", createdAt)
+	}
+
+	// В JSON Schema вместо nullable - тип "null" в списке
+	blog = generateSchemas(t, false, &schemaTestBlog{})["schemaTestBlog"]
+	if got := schemaProperty(t, blog, "DeletedAt")["type"]; !reflect.DeepEqual(got, []string{"string", "null"}) {
+		t.Errorf("JSON Schema: DeletedAt type = %v", got)
+	}
+}
+
+func TestSchemaRelations(t *testing.T) {
+	schemas := generateSchemas(t, true, &User{})
+	for _, name := range []string{"Post", "Comment", "UserAddress", "UserCompany"} {
+		if schemas[name] == nil {
+			t.Errorf("нет схемы %s для связи", name)
+		}
+	}
+
+	// has many - массив ссылок
+	posts := schemaProperty(t, schemas["User"], "Posts")
+	if posts["type"] != "array" || !reflect.DeepEqual(posts["items"], jsonObject{"$ref": "#/components/schemas/Post"}) {
+		t.Errorf("Posts = %v", posts)
+	}
+	if posts["x-gorm-relation"] != "has_many" || posts["x-gorm-foreign-key"] != "user_id" {
+		t.Errorf("Posts = %v", posts)
+	}
+
+	// has one: в OpenAPI 3.0 ссылка в allOf, чтобы не терялись x-gorm-*
+	address := schemaProperty(t, schemas["User"], "Address")
+	if !reflect.DeepEqual(address["allOf"], []jsonObject{{"$ref": "#/components/schemas/UserAddress"}}) || address["x-gorm-relation"] != "has_one" {
+		t.Errorf("Address = %v", address)
+	}
+
+	// В JSON Schema - $ref напрямую
+	schemas = generateSchemas(t, false, &User{})
+	if got := schemaProperty(t, schemas["User"], "Address")["$ref"]; got != "#/$defs/UserAddress" {
+		t.Errorf("JSON Schema: Address $ref = %v", got)
+	}
+}
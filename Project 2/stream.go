@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+
+	"gorm.io/gorm"
+)
+
+// Потоковое чтение больших выборок без загрузки всей таблицы в слайс:
+//
+//	for comment, err := range Stream[Comment](ctx, db.Where("post_id < ?", 10)) {
+//		if err != nil { ... }
+//	}
+//
+// При выходе из цикла (break) или отмене контекста курсор закрывается.
+
+// Построчно через курсор (Rows). db может содержать Where, Joins, Select и т.д.
+func Stream[T any](ctx context.Context, db *gorm.DB) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+
+		tx := db.WithContext(ctx)
+		if tx.Statement.Model == nil && tx.Statement.Table == "" {
+			tx = tx.Model(new(T))
+		}
+
+		rows, err := tx.Rows()
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			if err := ctx.Err(); err != nil {
+				yield(zero, err)
+				return
+			}
+
+			var item T
+			if err := tx.ScanRows(rows, &item); err != nil {
+				yield(zero, err)
+				return
+			}
+			if !yield(item, nil) {
+				return
+			}
+		}
+
+		if err := rows.Err(); err != nil {
+			yield(zero, err)
+		}
+	}
+}
+
+var errStopStream = errors.New("stream stopped")
+
+// Пачками по batchSize через FindInBatches (WHERE id > последний id LIMIT n):
+// соединение не держится открытым на все время обхода
+func StreamInBatches[T any](ctx context.Context, db *gorm.DB, batchSize int) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		var batch []T
+
+		err := db.WithContext(ctx).FindInBatches(&batch, batchSize, func(tx *gorm.DB, _ int) error {
+			for _, item := range batch {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				if !yield(item, nil) {
+					return errStopStream
+				}
+			}
+			return nil
+		}).Error
+
+		if err != nil && !errors.Is(err, errStopStream) {
+			yield(zero, err)
+		}
+	}
+}
+
+func usersALLStream(ctx context.Context, db *gorm.DB) {
+	for user, err := range StreamInBatches[User](ctx, db.Preload("Address").Preload("Company"), 100) {
+		if err != nil {
+			fmt.Println("Ошибка:", err)
+			return
+		}
+
+		fmt.Printf("ID: %d\n", user.ID)
+		fmt.Printf("Name: %s\n", user.Name)
+		fmt.Printf("City: %s\n", user.Address.City)
+		fmt.Printf("Company: %s\n", user.Company.Name)
+		fmt.Println("-------------")
+	}
+}
+
+func StreamUserCommentPostData(ctx context.Context, db *gorm.DB) iter.Seq2[UserCommentPostData, error] {
+	return Stream[UserCommentPostData](ctx, db.Model(&Comment{}).
+		Select("users.id as user_id, users.name as user_name, posts.id as post_id, posts.title as post_title, comments.id as comment_id, comments.body as comment_body").
+		Joins("LEFT JOIN posts ON comments.post_id = posts.id AND posts.tenant_id = comments.tenant_id").
+		Joins("LEFT JOIN users ON posts.user_id = users.id AND users.tenant_id = posts.tenant_id"))
+}
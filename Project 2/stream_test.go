@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+type streamTestItem struct {
+	ID uint `gorm:"primaryKey"`
+	N  int
+}
+
+func openStreamTestDB(t *testing.T, n int) (*gorm.DB, *int) {
+	t.Helper()
+	db := openTestDB(t, &streamTestItem{})
+
+	items := make([]streamTestItem, n)
+	for i := range items {
+		items[i].N = i + 1
+	}
+	if err := db.Create(&items).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// Число выполненных SELECT
+	queries := new(int)
+	err := db.Callback().Query().After("gorm:query").Register("test:count_queries", func(*gorm.DB) {
+		*queries++
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, queries
+}
+
+func TestStreamInBatches(t *testing.T) {
+	db, queries := openStreamTestDB(t, 10)
+
+	var sum int
+	for item, err := range StreamInBatches[streamTestItem](context.Background(), db, 3) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum += item.N
+	}
+	if sum != 55 || *queries != 4 {
+		t.Errorf("сумма %d, запросов %d; ожидалось 55 и 4", sum, *queries)
+	}
+}
+
+func TestStreamInBatchesBreak(t *testing.T) {
+	db, queries := openStreamTestDB(t, 10)
+
+	// После break следующие пачки не запрашиваются
+	var got []int
+	for item, err := range StreamInBatches[streamTestItem](context.Background(), db, 3) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, item.N)
+		if len(got) == 4 {
+			break
+		}
+	}
+	if len(got) != 4 || *queries != 2 {
+		t.Errorf("получено %v, запросов %d; ожидалось 4 записи и 2 запроса", got, *queries)
+	}
+}
+
+func TestStreamBreakClosesCursor(t *testing.T) {
+	db, _ := openStreamTestDB(t, 10)
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, err := range Stream[streamTestItem](context.Background(), db) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		break
+	}
+	if inUse := sqlDB.Stats().InUse; inUse != 0 {
+		t.Errorf("после break занято соединений: %d", inUse)
+	}
+}
+
+func TestStreamErrors(t *testing.T) {
+	db, _ := openStreamTestDB(t, 10)
+
+	// Ошибка запроса - единственный элемент последовательности
+	collect := func(seq iter.Seq2[streamTestItem, error]) (int, error) {
+		var n int
+		for _, err := range seq {
+			if err != nil {
+				return n, err
+			}
+			n++
+		}
+		return n, nil
+	}
+
+	broken := db.Table("no_such_table")
+	if n, err := collect(Stream[streamTestItem](context.Background(), broken)); err == nil || n != 0 {
+		t.Errorf("Stream: %d записей, ошибка %v", n, err)
+	}
+	if n, err := collect(StreamInBatches[streamTestItem](context.Background(), broken, 3)); err == nil || n != 0 {
+		t.Errorf("StreamInBatches: %d записей, ошибка %v", n, err)
+	}
+
+	// Отмена контекста во время обхода
+	for name, stream := range map[string]func(context.Context) iter.Seq2[streamTestItem, error]{
+		"Stream": func(ctx context.Context) iter.Seq2[streamTestItem, error] {
+			return Stream[streamTestItem](ctx, db)
+		},
+		"StreamInBatches": func(ctx context.Context) iter.Seq2[streamTestItem, error] {
+			return StreamInBatches[streamTestItem](ctx, db, 3)
+		},
+	} {
+		ctx, cancel := context.WithCancel(context.Background())
+		var n int
+		var streamErr error
+		for _, err := range stream(ctx) {
+			if err != nil {
+				streamErr = err
+				break
+			}
+			if n++; n == 2 {
+				cancel()
+			}
+		}
+		cancel()
+		if !errors.Is(streamErr, context.Canceled) || n != 2 {
+			t.Errorf("%s: %d записей, ошибка %v", name, n, streamErr)
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// Несколько команд (арендаторов) в одной базе.
+//
+// Вариант 1 - столбец tenant_id в каждой таблице. TenantPlugin берет
+// арендатора из контекста запроса и:
+//   - добавляет WHERE tenant_id = ? к Find/First/Count/Row, Update и Delete
+//     (в том числе к Preload - он выполняется с тем же контекстом);
+//   - заполняет tenant_id у новых записей;
+//   - не дает записать строку с чужим tenant_id.
+// db.Raw/db.Exec и запросы через db.Table(...) со Scan в произвольную
+// структуру плагин не видит - в них нужен TenantScope или TenantCondition,
+// а связанные таблицы соединяются с условием по tenant_id.
+//
+// Плагин подключается в main: HTTP API берут арендатора из X-Tenant-ID
+// (tenantMiddleware), консольные примеры и команды - из TENANT_ID,
+// без него работают со всеми арендаторами (WithoutTenant).
+//
+// Вариант 2 - отдельная схема Postgres на арендатора и переключение
+// search_path в транзакции (InTenantSchema).
+
+var (
+	ErrNoTenant    = errors.New("арендатор не указан в контексте")
+	ErrCrossTenant = errors.New("запись принадлежит другому арендатору")
+)
+
+const tenantColumn = "tenant_id"
+
+type tenantKey struct{}
+
+type tenantBypassKey struct{}
+
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantKey{}).(string)
+	return tenant, ok && tenant != ""
+}
+
+// Запросы без фильтра по арендатору (миграции, загрузка данных, админка)
+func WithoutTenant(ctx context.Context) context.Context {
+	return context.WithValue(ctx, tenantBypassKey{}, true)
+}
+
+// Арендатор из заголовка X-Tenant-ID
+func tenantMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant := r.Header.Get("X-Tenant-ID")
+		if tenant == "" {
+			http.Error(w, "не указан X-Tenant-ID", http.StatusBadRequest)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithTenant(r.Context(), tenant)))
+	})
+}
+
+// Фильтр по арендатору для запросов, которые плагин не обрабатывает:
+//
+//	db.Table("users").Scopes(TenantScope("users")).Joins(...).Scan(&rows)
+func TenantScope(table string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		condition, err := TenantCondition(db, table)
+		if err != nil {
+			db.AddError(err)
+			return db
+		}
+		return db.Where(condition)
+	}
+}
+
+// Условие tenant_id = ? для таблицы (или псевдонима) в db.Raw.
+// Без плагина и с WithoutTenant - 1 = 1, без арендатора - ErrNoTenant.
+//
+//	condition, err := TenantCondition(db, "u")
+//	db.Raw("SELECT ... FROM users u JOIN posts p ON p.user_id = u.id AND p.tenant_id = u.tenant_id WHERE ?", condition)
+func TenantCondition(db *gorm.DB, table string) (clause.Expression, error) {
+	if _, ok := db.Config.Plugins[TenantPlugin{}.Name()]; !ok {
+		return clause.Expr{SQL: "1 = 1"}, nil
+	}
+
+	ctx := db.Statement.Context
+	if bypass, _ := ctx.Value(tenantBypassKey{}).(bool); bypass {
+		return clause.Expr{SQL: "1 = 1"}, nil
+	}
+
+	tenant, ok := TenantFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("%w (таблица %s)", ErrNoTenant, table)
+	}
+	return clause.Eq{Column: clause.Column{Table: table, Name: tenantColumn}, Value: tenant}, nil
+}
+
+type TenantPlugin struct{}
+
+func (TenantPlugin) Name() string {
+	return "tenancy"
+}
+
+func (p TenantPlugin) Initialize(db *gorm.DB) error {
+	callbacks := []struct {
+		register func(name string, fn func(*gorm.DB)) error
+		name     string
+		fn       func(*gorm.DB)
+	}{
+		{db.Callback().Create().Before("gorm:create").Register, "tenancy:create", p.create},
+		{db.Callback().Query().Before("gorm:query").Register, "tenancy:query", p.scope},
+		{db.Callback().Row().Before("gorm:row").Register, "tenancy:row", p.scope},
+		{db.Callback().Update().Before("gorm:update").Register, "tenancy:update", p.update},
+		{db.Callback().Delete().Before("gorm:delete").Register, "tenancy:delete", p.scope},
+	}
+
+	for _, c := range callbacks {
+		if err := c.register(c.name, c.fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Арендатор текущего запроса; ok = false - модель без tenant_id или обход
+func tenantOf(db *gorm.DB) (field *schema.Field, tenant string, ok bool) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return nil, "", false
+	}
+	field = db.Statement.Schema.LookUpField(tenantColumn)
+	if field == nil {
+		return nil, "", false
+	}
+
+	ctx := db.Statement.Context
+	if bypass, _ := ctx.Value(tenantBypassKey{}).(bool); bypass {
+		return nil, "", false
+	}
+
+	tenant, found := TenantFromContext(ctx)
+	if !found {
+		db.AddError(fmt.Errorf("%w (таблица %s)", ErrNoTenant, db.Statement.Schema.Table))
+		return nil, "", false
+	}
+	return field, tenant, true
+}
+
+func (TenantPlugin) scope(db *gorm.DB) {
+	field, tenant, ok := tenantOf(db)
+	if !ok {
+		return
+	}
+
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: tenant},
+	}})
+}
+
+// Новые записи получают tenant_id из контекста, чужой tenant_id - ошибка
+func (TenantPlugin) create(db *gorm.DB) {
+	field, tenant, ok := tenantOf(db)
+	if !ok {
+		return
+	}
+
+	ctx := db.Statement.Context
+	eachRecord(db.Statement.ReflectValue, func(record reflect.Value) {
+		value, zero := field.ValueOf(ctx, record)
+		if zero {
+			db.AddError(field.Set(ctx, record, tenant))
+		} else if value != tenant {
+			db.AddError(ErrCrossTenant)
+		}
+	})
+}
+
+func (p TenantPlugin) update(db *gorm.DB) {
+	field, tenant, ok := tenantOf(db)
+	if !ok {
+		return
+	}
+
+	// Перенос записи к другому арендатору запрещен
+	switch dest := db.Statement.Dest.(type) {
+	case map[string]interface{}:
+		for key, value := range dest {
+			if f := db.Statement.Schema.LookUpField(key); f == field && value != tenant {
+				db.AddError(ErrCrossTenant)
+				return
+			}
+		}
+	default:
+		destValue := reflect.Indirect(reflect.ValueOf(dest))
+		if destValue.Kind() == reflect.Struct && destValue.Type() == db.Statement.Schema.ModelType {
+			if value, zero := field.ValueOf(db.Statement.Context, destValue); !zero && value != tenant {
+				db.AddError(ErrCrossTenant)
+				return
+			}
+		}
+	}
+
+	// Save обновляет все поля: пустой tenant_id заменяем текущим
+	if db.Statement.ReflectValue.Kind() == reflect.Struct {
+		if _, zero := field.ValueOf(db.Statement.Context, db.Statement.ReflectValue); zero {
+			db.AddError(field.Set(db.Statement.Context, db.Statement.ReflectValue, tenant))
+		}
+	}
+
+	p.scope(db)
+}
+
+func eachRecord(value reflect.Value, fn func(record reflect.Value)) {
+	switch value.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			fn(reflect.Indirect(value.Index(i)))
+		}
+	case reflect.Struct:
+		fn(value)
+	}
+}
+
+// Схема на арендатора: tenant_<имя> с собственными таблицами.
+// Имя арендатора подставляется в SQL, поэтому допускаются только [a-z0-9_].
+
+var tenantNamePattern = regexp.MustCompile(`^[a-z0-9_]{1,50}$`)
+
+func tenantSchemaName(tenant string) (string, error) {
+	if !tenantNamePattern.MatchString(tenant) {
+		return "", fmt.Errorf("недопустимое имя арендатора %q", tenant)
+	}
+	return "tenant_" + tenant, nil
+}
+
+// Создание схемы арендатора и таблиц в ней
+func createTenantSchema(db *gorm.DB, tenant string) error {
+	name, err := tenantSchemaName(tenant)
+	if err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`CREATE SCHEMA IF NOT EXISTS "` + name + `"`).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(`SET LOCAL search_path TO "` + name + `"`).Error; err != nil {
+			return err
+		}
+		return tx.AutoMigrate(&User{}, &UserAddress{}, &UserCompany{}, &Post{}, &Comment{})
+	})
+}
+
+// Запросы fn выполняются в схеме арендатора. SET LOCAL действует только
+// до конца транзакции, поэтому соединение возвращается в пул без изменений.
+func InTenantSchema(ctx context.Context, db *gorm.DB, tenant string, fn func(tx *gorm.DB) error) error {
+	name, err := tenantSchemaName(tenant)
+	if err != nil {
+		return err
+	}
+
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`SET LOCAL search_path TO "` + name + `", public`).Error; err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+}
+
+// Плагин подключен в main
+func exampleTenancy(db *gorm.DB) {
+	teamA := db.WithContext(WithTenant(context.Background(), "team_a"))
+	teamB := db.WithContext(WithTenant(context.Background(), "team_b"))
+
+	// tenant_id заполняется автоматически
+	user := User{Name: "Tenant User", Email: "tenant@example.com"}
+	teamA.Create(&user)
+
+	// Другой арендатор запись не видит и не может изменить
+	var found []User
+	teamB.Find(&found, user.ID)
+	fmt.Println("team_b видит:", len(found)) // 0
+
+	result := teamB.Model(&User{}).Where("id = ?", user.ID).Update("name", "Hacked")
+	fmt.Println("team_b обновил:", result.RowsAffected) // 0
+
+	// Попытка перенести запись к другому арендатору
+	err := teamA.Model(&user).Update("tenant_id", "team_b").Error
+	fmt.Println(errors.Is(err, ErrCrossTenant)) // true
+
+	// Без арендатора - ошибка
+	err = db.WithContext(context.Background()).Find(&found).Error
+	fmt.Println(errors.Is(err, ErrNoTenant)) // true
+
+	// Схема на арендатора
+	if err := createTenantSchema(db, "team_c"); err != nil {
+		fmt.Println("Ошибка:", err)
+		return
+	}
+	InTenantSchema(WithoutTenant(context.Background()), db, "team_c", func(tx *gorm.DB) error {
+		var count int64
+		tx.Model(&User{}).Count(&count)
+		fmt.Println("Пользователей в схеме team_c:", count)
+		return nil
+	})
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestTenantRawQueries(t *testing.T) {
+	db := openTestDB(t, &User{}, &Post{}, &Comment{}, &OutboxEvent{})
+	if err := db.Use(TenantPlugin{}); err != nil {
+		t.Fatal(err)
+	}
+	teamA := db.WithContext(WithTenant(context.Background(), "team_a"))
+	teamB := db.WithContext(WithTenant(context.Background(), "team_b"))
+
+	// Email уникален в пределах арендатора - у team_b такой же
+	userA := User{Name: "A", Email: "same@example.com"}
+	userB := User{Name: "B", Email: "same@example.com"}
+	if err := teamA.Create(&userA).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := teamB.Create(&userB).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// Пост team_b с тем же user_id создан раньше постов team_a
+	stray := Post{UserID: userA.ID, Title: "stray"}
+	teamB.Create(&stray)
+	teamA.Create(&[]Post{{UserID: userA.ID, Title: "a1"}, {UserID: userA.ID, Title: "a2"}})
+	teamB.Create(&Comment{PostID: stray.ID, Email: "same@example.com", Body: "comment"})
+
+	t.Run("TenantScope", func(t *testing.T) {
+		var names []string
+		teamA.Table("users").Scopes(TenantScope("users")).Pluck("name", &names)
+		if len(names) != 1 || names[0] != "A" {
+			t.Errorf("team_a видит %v", names)
+		}
+
+		db.WithContext(WithoutTenant(context.Background())).Table("users").Scopes(TenantScope("users")).Pluck("name", &names)
+		if len(names) != 2 {
+			t.Errorf("WithoutTenant: %v", names)
+		}
+
+		err := db.Table("users").Scopes(TenantScope("users")).Pluck("name", &names).Error
+		if !errors.Is(err, ErrNoTenant) {
+			t.Errorf("без арендатора: %v", err)
+		}
+	})
+
+	t.Run("TenantCondition без плагина", func(t *testing.T) {
+		if _, err := TenantCondition(openTestDB(t), "users"); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("FindTop3PostsPerUser", func(t *testing.T) {
+		posts := FindTop3PostsPerUser(teamA)
+		if len(posts) != 2 {
+			t.Fatalf("team_a: %+v", posts)
+		}
+		for _, post := range posts {
+			if post.PostID == stray.ID {
+				t.Errorf("пост team_b в выборке team_a")
+			}
+		}
+	})
+
+	t.Run("TopNPerGroup", func(t *testing.T) {
+		posts, err := TopNPerGroup[Post](teamA, TopN{N: 1, PartitionBy: "UserID"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(posts) != 1 || posts[0].Title != "a1" {
+			t.Errorf("team_a: %+v", posts)
+		}
+	})
+
+	t.Run("GetUserEngagementReport", func(t *testing.T) {
+		report := GetUserEngagementReport(teamA)
+		if len(report.Users) != 1 {
+			t.Fatalf("team_a: %+v", report.Users)
+		}
+		if user := report.Users[0]; user.PostCount != 2 || user.CommentsReceived != 0 || user.CommentsWritten != 0 {
+			t.Errorf("team_a: %+v", user)
+		}
+
+		report = GetUserEngagementReport(teamB)
+		if len(report.Users) != 1 || report.Users[0].CommentsWritten != 1 || report.Users[0].PostCount != 0 {
+			t.Errorf("team_b: %+v", report.Users)
+		}
+	})
+}
+
+func TestTenantTransfer(t *testing.T) {
+	db := openTestDB(t, transferTestModels...)
+	if err := db.Use(TenantPlugin{}); err != nil {
+		t.Fatal(err)
+	}
+	teamA := db.WithContext(WithTenant(context.Background(), "team_a"))
+	teamB := db.WithContext(WithTenant(context.Background(), "team_b"))
+
+	teamA.Create(&User{Name: "A", Email: "a@example.com", Posts: []Post{{Title: "a1"}}})
+	teamB.Create(&User{Name: "B", Email: "b@example.com", Posts: []Post{{Title: "b1"}, {Title: "b2"}}})
+
+	tables, err := selectTransferTables(db, []string{"users", "posts"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := exportTables(teamA, tables, dir, "ndjson"); err != nil {
+		t.Fatal(err)
+	}
+
+	// В выгрузке team_a только ее строки
+	target := openTestDB(t, transferTestModels...)
+	if err := importTables(target, tables, dir, "ndjson"); err != nil {
+		t.Fatal(err)
+	}
+	var names, titles []string
+	target.Model(&User{}).Order("id").Pluck("name", &names)
+	target.Model(&Post{}).Order("id").Pluck("title", &titles)
+	if len(names) != 1 || names[0] != "A" || len(titles) != 1 || titles[0] != "a1" {
+		t.Errorf("выгружено: %v %v", names, titles)
+	}
+
+	// Без арендатора выгрузка не выполняется
+	if err := exportTables(db, tables, t.TempDir(), "ndjson"); !errors.Is(err, ErrNoTenant) {
+		t.Errorf("без арендатора: %v", err)
+	}
+
+	// Выгрузку team_a нельзя загрузить от имени team_b
+	other := openTestDB(t, transferTestModels...)
+	if err := other.Use(TenantPlugin{}); err != nil {
+		t.Fatal(err)
+	}
+	otherB := other.WithContext(WithTenant(context.Background(), "team_b"))
+	if err := importTables(otherB, tables, dir, "ndjson"); !errors.Is(err, ErrCrossTenant) {
+		t.Errorf("загрузка чужих строк: %v", err)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// Обобщение FindTop3PostsPerUser: первые N дочерних записей в каждой группе
+// (посты пользователя, комментарии поста, товары с одним кодом и т.д.).
+// На Postgres строится запрос с ROW_NUMBER() OVER (PARTITION BY ...),
+// на SQLite - эквивалент через коррелированный подзапрос с COUNT(*).
+// У моделей с tenant_id группы не пересекают границу арендатора,
+// а сами запросы проходят через плагин арендаторов (tenancy.go).
+
+type TopN struct {
+	N           int
+	PartitionBy string // поле группы, например "UserID" или "user_id"
+	OrderBy     string // поле сортировки внутри группы, по умолчанию первичный ключ
+	Desc        bool
+}
+
+// Первые N записей модели T в каждой группе opts.PartitionBy.
+// При равенстве OrderBy порядок определяет первичный ключ.
+func TopNPerGroup[T any](db *gorm.DB, opts TopN) ([]T, error) {
+	return topNPerGroup[T](db, opts, db.Dialector.Name() != "sqlite")
+}
+
+// rowNumber: true - ROW_NUMBER() OVER, false - коррелированный подзапрос
+// (SQLite поддерживает оба варианта, тест сравнивает их результаты)
+func topNPerGroup[T any](db *gorm.DB, opts TopN, rowNumber bool) ([]T, error) {
+	var result []T
+
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(new(T)); err != nil {
+		return nil, err
+	}
+
+	primary := stmt.Schema.PrioritizedPrimaryField
+	if primary == nil {
+		return nil, fmt.Errorf("у модели %s нет первичного ключа", stmt.Schema.Name)
+	}
+
+	partition := stmt.Schema.LookUpField(opts.PartitionBy)
+	if partition == nil {
+		return nil, fmt.Errorf("у модели %s нет поля %q", stmt.Schema.Name, opts.PartitionBy)
+	}
+
+	order := primary
+	if opts.OrderBy != "" {
+		if order = stmt.Schema.LookUpField(opts.OrderBy); order == nil {
+			return nil, fmt.Errorf("у модели %s нет поля %q", stmt.Schema.Name, opts.OrderBy)
+		}
+	}
+
+	direction, compare := "ASC", "<"
+	if opts.Desc {
+		direction, compare = "DESC", ">"
+	}
+
+	table := stmt.Quote(stmt.Schema.Table)
+	partitionColumn := stmt.Quote(partition.DBName)
+	orderColumn := stmt.Quote(order.DBName)
+	primaryColumn := stmt.Quote(primary.DBName)
+	// Сортировка по первичному ключу уже однозначна - без второго ключа
+	rowOrder := fmt.Sprintf("%s %s", orderColumn, direction)
+	if order != primary {
+		rowOrder += ", " + primaryColumn
+	}
+	orderBy := partitionColumn + ", " + rowOrder
+
+	// Группа - внутри одного арендатора
+	tenant := stmt.Schema.LookUpField(tenantColumn)
+	partitionBy := partitionColumn
+	if tenant != nil {
+		partitionBy = stmt.Quote(tenant.DBName) + ", " + partitionColumn
+	}
+
+	var err error
+	if !rowNumber {
+		// Запись входит в первые N, если "выше" нее в группе меньше N записей
+		above := fmt.Sprintf("t2.%[2]s %[3]s %[1]s.%[2]s", table, orderColumn, compare)
+		if order != primary {
+			above = fmt.Sprintf("(%[4]s OR (t2.%[2]s = %[1]s.%[2]s AND t2.%[3]s < %[1]s.%[3]s))",
+				table, orderColumn, primaryColumn, above)
+		}
+		ranked := fmt.Sprintf(`(SELECT COUNT(*) FROM %[1]s AS t2
+			WHERE t2.%[2]s = %[1]s.%[2]s AND %[3]s`, table, partitionColumn, above)
+		if tenant != nil {
+			ranked += fmt.Sprintf(" AND t2.%[2]s = %[1]s.%[2]s", table, stmt.Quote(tenant.DBName))
+		}
+		if deletedAt := stmt.Schema.LookUpField("DeletedAt"); deletedAt != nil {
+			ranked += fmt.Sprintf(" AND t2.%s IS NULL", stmt.Quote(deletedAt.DBName))
+		}
+		ranked += ") < ?"
+
+		err = db.Model(new(T)).
+			Where(ranked, opts.N).
+			Order(orderBy).
+			Find(&result).Error
+	} else {
+		subquery := db.Model(new(T)).
+			Select(fmt.Sprintf("*, ROW_NUMBER() OVER (PARTITION BY %s ORDER BY %s) as row_num", partitionBy, rowOrder))
+
+		err = db.Table("(?) AS ranked", subquery).
+			Where("row_num <= ?", opts.N).
+			Order(orderBy).
+			Find(&result).Error
+	}
+
+	return result, err
+}
+
+// Первые N записей ассоциации для каждого родителя,
+// например TopNPerAssociation[Post](db, &User{}, "Posts", 3, "id", false).
+// Поле группы берется из внешнего ключа ассоциации.
+func TopNPerAssociation[T any](db *gorm.DB, parent interface{}, association string, n int, orderBy string, desc bool) ([]T, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(parent); err != nil {
+		return nil, err
+	}
+
+	relation, ok := stmt.Schema.Relationships.Relations[association]
+	if !ok || len(relation.References) == 0 {
+		return nil, fmt.Errorf("у модели %s нет ассоциации %q", stmt.Schema.Name, association)
+	}
+
+	return TopNPerGroup[T](db, TopN{
+		N:           n,
+		PartitionBy: relation.References[0].ForeignKey.DBName,
+		OrderBy:     orderBy,
+		Desc:        desc,
+	})
+}
+
+func FindTopPostsPerUser(db *gorm.DB, n int) []Post {
+	posts, err := TopNPerAssociation[Post](db, &User{}, "Posts", n, "id", false)
+	if err != nil {
+		fmt.Println("Ошибка:", err)
+	}
+
+	for _, post := range posts {
+		fmt.Printf("user.id: %d\n", post.UserID)
+		fmt.Printf("post.id: %d\n", post.ID)
+		fmt.Printf("post.title: %s\n", post.Title)
+		fmt.Println("-------------")
+	}
+
+	return posts
+}
+
+func FindLatestCommentsPerPost(db *gorm.DB, n int) []Comment {
+	comments, err := TopNPerAssociation[Comment](db, &Post{}, "Comments", n, "id", true)
+	if err != nil {
+		fmt.Println("Ошибка:", err)
+	}
+
+	for _, comment := range comments {
+		fmt.Printf("post.id: %d\n", comment.PostID)
+		fmt.Printf("comment.id: %d\n", comment.ID)
+		fmt.Printf("comment.name: %s\n", comment.Name)
+		fmt.Println("-------------")
+	}
+
+	return comments
+}
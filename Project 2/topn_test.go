@@ -0,0 +1,85 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+type topNTestScore struct {
+	ID        uint `gorm:"primaryKey"`
+	GroupID   uint
+	Score     int
+	DeletedAt gorm.DeletedAt
+}
+
+func scoreIDs(scores []topNTestScore) []uint {
+	ids := make([]uint, len(scores))
+	for i, score := range scores {
+		ids[i] = score.ID
+	}
+	return ids
+}
+
+func TestTopNStrategies(t *testing.T) {
+	db := openTestDB(t, &topNTestScore{})
+
+	// Равные Score внутри групп; запись 5 удалена и в выборку не попадает
+	scores := []topNTestScore{
+		{ID: 1, GroupID: 1, Score: 10}, {ID: 2, GroupID: 1, Score: 30}, {ID: 3, GroupID: 1, Score: 30},
+		{ID: 4, GroupID: 1, Score: 20}, {ID: 5, GroupID: 1, Score: 40}, {ID: 6, GroupID: 1, Score: 10},
+		{ID: 7, GroupID: 2, Score: 5}, {ID: 8, GroupID: 2, Score: 5}, {ID: 9, GroupID: 2, Score: 5},
+		{ID: 10, GroupID: 3, Score: 1},
+	}
+	if err := db.Create(&scores).Error; err != nil {
+		t.Fatal(err)
+	}
+	db.Delete(&topNTestScore{ID: 5})
+
+	tests := []struct {
+		opts TopN
+		want []uint
+	}{
+		{TopN{N: 2, PartitionBy: "GroupID"}, []uint{1, 2, 7, 8, 10}},
+		{TopN{N: 2, PartitionBy: "GroupID", Desc: true}, []uint{6, 4, 9, 8, 10}},
+		{TopN{N: 2, PartitionBy: "GroupID", OrderBy: "Score"}, []uint{1, 6, 7, 8, 10}},
+		{TopN{N: 3, PartitionBy: "GroupID", OrderBy: "Score", Desc: true}, []uint{2, 3, 4, 7, 8, 9, 10}},
+		{TopN{N: 1, PartitionBy: "group_id", OrderBy: "score", Desc: true}, []uint{2, 7, 10}},
+	}
+	for _, test := range tests {
+		for _, rowNumber := range []bool{true, false} {
+			got, err := topNPerGroup[topNTestScore](db, test.opts, rowNumber)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ids := scoreIDs(got); !reflect.DeepEqual(ids, test.want) {
+				t.Errorf("%+v, rowNumber=%v: %v, ожидалось %v", test.opts, rowNumber, ids, test.want)
+			}
+		}
+	}
+}
+
+func TestTopNPrimaryKeyOrder(t *testing.T) {
+	db := openTestDB(t, &topNTestScore{})
+
+	for _, rowNumber := range []bool{true, false} {
+		queries, err := captureQueries(db, func(tx *gorm.DB) {
+			topNPerGroup[topNTestScore](tx, TopN{N: 2, PartitionBy: "GroupID"}, rowNumber)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(queries) == 0 {
+			t.Fatalf("rowNumber=%v: нет запросов", rowNumber)
+		}
+
+		// При сортировке по первичному ключу второй ключ не нужен
+		// (подзапрос ROW_NUMBER захватывается отдельно, итоговый запрос - последний)
+		sql := queries[len(queries)-1].SQL
+		if strings.Contains(sql, "`id` ASC,") || strings.Contains(sql, "t2.`id` =") {
+			t.Errorf("rowNumber=%v: %s", rowNumber, sql)
+		}
+	}
+}
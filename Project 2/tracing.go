@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// TracingPlugin - плагин GORM, который создает span OpenTelemetry
+// на каждый Create, Find, Update, Delete, Raw и Exec.
+// Родительский span берется из контекста запроса: db.WithContext(r.Context()).
+type TracingPlugin struct {
+	tracer trace.Tracer
+}
+
+const tracingSpanKey = "tracing:span"
+
+func NewTracingPlugin(provider trace.TracerProvider) *TracingPlugin {
+	return &TracingPlugin{tracer: provider.Tracer("gorm")}
+}
+
+func (p *TracingPlugin) Name() string {
+	return "tracing"
+}
+
+func (p *TracingPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	operations := []struct {
+		name   string
+		before func(name string, fn func(*gorm.DB)) error
+		after  func(name string, fn func(*gorm.DB)) error
+	}{
+		{"create", cb.Create().Before("gorm:create").Register, cb.Create().After("gorm:create").Register},
+		{"query", cb.Query().Before("gorm:query").Register, cb.Query().After("gorm:query").Register},
+		{"update", cb.Update().Before("gorm:update").Register, cb.Update().After("gorm:update").Register},
+		{"delete", cb.Delete().Before("gorm:delete").Register, cb.Delete().After("gorm:delete").Register},
+		{"row", cb.Row().Before("gorm:row").Register, cb.Row().After("gorm:row").Register},
+		{"raw", cb.Raw().Before("gorm:raw").Register, cb.Raw().After("gorm:raw").Register},
+	}
+
+	for _, op := range operations {
+		if err := op.before("tracing:before_"+op.name, p.before(op.name)); err != nil {
+			return err
+		}
+		if err := op.after("tracing:after_"+op.name, p.after); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *TracingPlugin) before(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		ctx := db.Statement.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+
+		ctx, span := p.tracer.Start(ctx, "gorm."+operation, trace.WithSpanKind(trace.SpanKindClient))
+		db.Statement.Context = ctx
+		db.InstanceSet(tracingSpanKey, span)
+	}
+}
+
+func (p *TracingPlugin) after(db *gorm.DB) {
+	value, ok := db.InstanceGet(tracingSpanKey)
+	if !ok {
+		return
+	}
+	span := value.(trace.Span)
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("db.system", db.Dialector.Name()),
+		attribute.String("db.statement", db.Statement.SQL.String()),
+		attribute.String("db.sql.table", db.Statement.Table),
+		attribute.Int64("db.rows_affected", db.RowsAffected),
+	)
+
+	// "Не найдено" - не ошибка для трассировки
+	if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+		span.RecordError(db.Error)
+		span.SetStatus(codes.Error, db.Error.Error())
+	}
+}
+
+// Провайдер трассировки с заданным экспортером.
+// В тестах можно передать tracetest.NewInMemoryExporter() и читать GetSpans().
+func newTracerProvider(exporter sdktrace.SpanExporter) *sdktrace.TracerProvider {
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSyncer(exporter),
+	)
+	otel.SetTracerProvider(provider)
+	return provider
+}
+
+// Пример HTTP API: span запроса создает otelhttp,
+// а span'ы GORM становятся его дочерними через r.Context()
+func serveTracedAPI(db *gorm.DB, addr string) {
+	fmt.Printf("API доступно на http://localhost%s/posts/count\n", addr)
+	if err := http.ListenAndServe(addr, newTracedMux(db)); err != nil {
+		panic("Не удалось запустить HTTP сервер")
+	}
+}
+
+// Маршруты API отдельно от запуска сервера - тест вызывает их через httptest.
+// Арендатор - из заголовка X-Tenant-ID (tenancy.go).
+func newTracedMux(db *gorm.DB) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.Handle("GET /posts/count", otelhttp.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var result []PostCountByUser
+		err := db.WithContext(r.Context()).
+			Model(&Post{}).
+			Select("user_id, COUNT(*) as post_count").
+			Group("user_id").
+			Scan(&result).Error
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}), "GET /posts/count"))
+
+	mux.Handle("POST /users", otelhttp.NewHandler(createUserHandler(db), "POST /users"))
+	mux.Handle("PUT /posts/{id}", otelhttp.NewHandler(updatePostHandler(db), "PUT /posts/{id}"))
+
+	return tenantMiddleware(mux)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func spanAttributes(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	attributes := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes {
+		attributes[kv.Key] = kv.Value
+	}
+	return attributes
+}
+
+func findSpan(t *testing.T, spans tracetest.SpanStubs, name string) tracetest.SpanStub {
+	t.Helper()
+	for _, span := range spans {
+		if span.Name == name {
+			return span
+		}
+	}
+	t.Fatalf("нет span'а %s", name)
+	return tracetest.SpanStub{}
+}
+
+func TestTracingSpans(t *testing.T) {
+	db := openTestDB(t, &Post{})
+	exporter := tracetest.NewInMemoryExporter()
+	provider := newTracerProvider(exporter)
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+	if err := db.Use(NewTracingPlugin(provider)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Use(OptimisticLockPlugin{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Use(TenantPlugin{}); err != nil {
+		t.Fatal(err)
+	}
+
+	db.WithContext(WithTenant(context.Background(), "team_a")).
+		Create(&[]Post{{UserID: 1, Title: "first"}, {UserID: 1, Title: "second"}, {UserID: 2, Title: "third"}})
+
+	mux := newTracedMux(db)
+	request := func(method, path, tenant string, body io.Reader) *http.Request {
+		r := httptest.NewRequest(method, path, body)
+		r.Header.Set("X-Tenant-ID", tenant)
+		return r
+	}
+
+	t.Run("арендатор", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httptest.NewRequest("GET", "/posts/count", nil))
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("без X-Tenant-ID код %d", recorder.Code)
+		}
+
+		recorder = httptest.NewRecorder()
+		mux.ServeHTTP(recorder, request("GET", "/posts/count", "team_b", nil))
+		if body := strings.TrimSpace(recorder.Body.String()); body != "null" {
+			t.Errorf("team_b видит посты team_a: %s", body)
+		}
+	})
+
+	t.Run("запрос", func(t *testing.T) {
+		exporter.Reset()
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, request("GET", "/posts/count", "team_a", nil))
+		if recorder.Code != 200 {
+			t.Fatalf("код %d: %s", recorder.Code, recorder.Body)
+		}
+
+		spans := exporter.GetSpans()
+		server := findSpan(t, spans, "GET /posts/count")
+		span := findSpan(t, spans, "gorm.row")
+
+		if span.Parent.SpanID() != server.SpanContext.SpanID() || span.SpanContext.TraceID() != server.SpanContext.TraceID() {
+			t.Errorf("span GORM не дочерний для span'а запроса")
+		}
+		attributes := spanAttributes(span)
+		if sql := attributes["db.statement"].AsString(); !strings.Contains(sql, "COUNT(*)") || !strings.Contains(sql, "GROUP BY") {
+			t.Errorf("db.statement = %q", sql)
+		}
+		if table := attributes["db.sql.table"].AsString(); table != "posts" {
+			t.Errorf("db.sql.table = %q", table)
+		}
+		if system := attributes["db.system"].AsString(); system != "sqlite" {
+			t.Errorf("db.system = %q", system)
+		}
+		if span.Status.Code != codes.Unset {
+			t.Errorf("статус %v без ошибки", span.Status.Code)
+		}
+	})
+
+	t.Run("изменение", func(t *testing.T) {
+		exporter.Reset()
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, request("PUT", "/posts/1", "team_a", strings.NewReader(`{"title":"changed","body":"b","version":1}`)))
+		if recorder.Code != 200 {
+			t.Fatalf("код %d: %s", recorder.Code, recorder.Body)
+		}
+
+		spans := exporter.GetSpans()
+		server := findSpan(t, spans, "PUT /posts/{id}")
+		span := findSpan(t, spans, "gorm.update")
+
+		if span.Parent.SpanID() != server.SpanContext.SpanID() {
+			t.Errorf("span GORM не дочерний для span'а запроса")
+		}
+		attributes := spanAttributes(span)
+		if sql := attributes["db.statement"].AsString(); !strings.HasPrefix(sql, "UPDATE `posts`") {
+			t.Errorf("db.statement = %q", sql)
+		}
+		if table := attributes["db.sql.table"].AsString(); table != "posts" {
+			t.Errorf("db.sql.table = %q", table)
+		}
+		if rows := attributes["db.rows_affected"].AsInt64(); rows != 1 {
+			t.Errorf("db.rows_affected = %d", rows)
+		}
+	})
+
+	t.Run("ошибка", func(t *testing.T) {
+		exporter.Reset()
+		db.Exec("UPDATE missing SET x = 1")
+
+		span := findSpan(t, exporter.GetSpans(), "gorm.raw")
+		if span.Status.Code != codes.Error || !strings.Contains(span.Status.Description, "missing") {
+			t.Errorf("статус %v %q", span.Status.Code, span.Status.Description)
+		}
+		if len(span.Events) == 0 || span.Events[0].Name != "exception" {
+			t.Errorf("ошибка не записана в span: %v", span.Events)
+		}
+		if sql := spanAttributes(span)["db.statement"].AsString(); sql != "UPDATE missing SET x = 1" {
+			t.Errorf("db.statement = %q", sql)
+		}
+	})
+
+	t.Run("не найдено", func(t *testing.T) {
+		exporter.Reset()
+		db.WithContext(WithTenant(context.Background(), "team_a")).First(&Post{}, 999)
+
+		span := findSpan(t, exporter.GetSpans(), "gorm.query")
+		if span.Status.Code != codes.Unset {
+			t.Errorf("\"не найдено\" записано как ошибка: %v", span.Status)
+		}
+		if rows := spanAttributes(span)["db.rows_affected"].AsInt64(); rows != 0 {
+			t.Errorf("db.rows_affected = %d", rows)
+		}
+	})
+}
@@ -0,0 +1,517 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Выгрузка и загрузка таблиц в JSON, NDJSON, CSV и Parquet.
+// Строки читаются и пишутся потоком, ID сохраняются,
+// загрузка идет в порядке внешних ключей, после нее сбрасываются последовательности.
+// С TENANT_ID выгружаются только строки арендатора, а при загрузке
+// строки другого арендатора отклоняются (ErrCrossTenant).
+
+// Таблицы в порядке внешних ключей: сначала родители, потом дочерние
+var transferModels = []interface{}{
+	&User{},
+	&UserAddress{},
+	&UserCompany{},
+	&Post{},
+	&Comment{},
+}
+
+const transferBatchSize = 500
+
+// Плоская структура только с колонками таблицы, без ассоциаций
+type transferTable struct {
+	Name    string
+	Type    reflect.Type
+	Columns []string
+}
+
+func newTransferTable(db *gorm.DB, model interface{}) (transferTable, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return transferTable{}, err
+	}
+
+	table := transferTable{Name: stmt.Schema.Table}
+
+	var fields []reflect.StructField
+	for _, field := range stmt.Schema.Fields {
+		if field.DBName == "" {
+			continue
+		}
+		fields = append(fields, reflect.StructField{
+			Name: field.Name,
+			Type: field.FieldType,
+			Tag:  reflect.StructTag(fmt.Sprintf(`gorm:"%s" json:"%s" parquet:"%s"`, transferGormTag(field), field.DBName, field.DBName)),
+		})
+		table.Columns = append(table.Columns, field.DBName)
+	}
+	table.Type = reflect.StructOf(fields)
+
+	return table, nil
+}
+
+func transferGormTag(field *schema.Field) string {
+	if field.PrimaryKey {
+		return "column:" + field.DBName + ";primaryKey"
+	}
+	return "column:" + field.DBName
+}
+
+func (t transferTable) new() interface{} {
+	return reflect.New(t.Type).Interface()
+}
+
+// Выбор таблиц по именам, пустой список - все таблицы
+func selectTransferTables(db *gorm.DB, names []string) ([]transferTable, error) {
+	all := len(names) == 0
+	wanted := map[string]bool{}
+	unknown := map[string]bool{}
+	for _, name := range names {
+		wanted[name] = true
+		unknown[name] = true
+	}
+
+	var tables []transferTable
+	for _, model := range transferModels {
+		table, err := newTransferTable(db, model)
+		if err != nil {
+			return nil, err
+		}
+		if all || wanted[table.Name] {
+			tables = append(tables, table)
+			delete(unknown, table.Name)
+		}
+	}
+
+	for _, name := range names {
+		if unknown[name] {
+			return nil, fmt.Errorf("неизвестная таблица %q", name)
+		}
+	}
+
+	return tables, nil
+}
+
+// Запись строк в файл выбранного формата
+type rowWriter interface {
+	Write(row interface{}) error
+	Close() error
+}
+
+// Чтение строк; io.EOF - конец файла
+type rowReader interface {
+	Read(row interface{}) error
+	Close() error
+}
+
+func exportTables(db *gorm.DB, tables []transferTable, dir, format string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	for _, table := range tables {
+		file, err := os.Create(filepath.Join(dir, table.Name+"."+format))
+		if err != nil {
+			return err
+		}
+
+		count, err := exportTable(db, table, file, format)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", table.Name, err)
+		}
+
+		fmt.Printf("%s: выгружено %d строк\n", table.Name, count)
+	}
+
+	return nil
+}
+
+func exportTable(db *gorm.DB, table transferTable, file *os.File, format string) (int, error) {
+	writer, err := newRowWriter(file, table, format)
+	if err != nil {
+		return 0, err
+	}
+
+	// Table(...).Rows() плагин арендаторов не видит - условие добавляется явно
+	rows, err := db.Table(table.Name).Scopes(TenantScope(table.Name)).Order("id").Rows()
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		row := table.new()
+		if err := db.ScanRows(rows, row); err != nil {
+			return count, err
+		}
+		if err := writer.Write(row); err != nil {
+			return count, err
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return count, err
+	}
+
+	return count, writer.Close()
+}
+
+func importTables(db *gorm.DB, tables []transferTable, dir, format string) error {
+	for _, table := range tables {
+		file, err := os.Open(filepath.Join(dir, table.Name+"."+format))
+		if err != nil {
+			return err
+		}
+
+		count, err := importTable(db, table, file, format)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", table.Name, err)
+		}
+
+		if err := resetSequence(db, table.Name); err != nil {
+			return fmt.Errorf("%s: %w", table.Name, err)
+		}
+
+		fmt.Printf("%s: загружено %d строк\n", table.Name, count)
+	}
+
+	return nil
+}
+
+func importTable(db *gorm.DB, table transferTable, file *os.File, format string) (int, error) {
+	reader, err := newRowReader(file, table, format)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+
+	count := 0
+	batch := reflect.MakeSlice(reflect.SliceOf(table.Type), 0, transferBatchSize)
+
+	flush := func() error {
+		if batch.Len() == 0 {
+			return nil
+		}
+		rows := reflect.New(batch.Type())
+		rows.Elem().Set(batch)
+		if err := db.Table(table.Name).Create(rows.Interface()).Error; err != nil {
+			return err
+		}
+		count += batch.Len()
+		batch = batch.Slice(0, 0)
+		return nil
+	}
+
+	for {
+		row := table.new()
+		err := reader.Read(row)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return count, err
+		}
+
+		batch = reflect.Append(batch, reflect.ValueOf(row).Elem())
+		if batch.Len() == transferBatchSize {
+			if err := flush(); err != nil {
+				return count, err
+			}
+		}
+	}
+
+	return count, flush()
+}
+
+// После загрузки с явными ID последовательность нужно сдвинуть на MAX(id)
+func resetSequence(db *gorm.DB, table string) error {
+	if db.Dialector.Name() != "postgres" {
+		return nil
+	}
+	return db.Exec(
+		fmt.Sprintf("SELECT setval(pg_get_serial_sequence('%[1]s', 'id'), COALESCE((SELECT MAX(id) FROM %[1]s), 0) + 1, false)", table),
+	).Error
+}
+
+func newRowWriter(w io.Writer, table transferTable, format string) (rowWriter, error) {
+	switch format {
+	case "json":
+		return &jsonRowWriter{w: bufio.NewWriter(w)}, nil
+	case "ndjson":
+		buffered := bufio.NewWriter(w)
+		return &ndjsonRowWriter{w: buffered, encoder: json.NewEncoder(buffered)}, nil
+	case "csv":
+		writer := csv.NewWriter(w)
+		return &csvRowWriter{w: writer, columns: table.Columns}, writer.Write(table.Columns)
+	case "parquet":
+		return &parquetRowWriter{w: parquet.NewWriter(w, parquet.SchemaOf(table.new()))}, nil
+	}
+	return nil, fmt.Errorf("неизвестный формат %q", format)
+}
+
+func newRowReader(file *os.File, table transferTable, format string) (rowReader, error) {
+	switch format {
+	case "json":
+		decoder := json.NewDecoder(bufio.NewReader(file))
+		// Пропускаем открывающую скобку массива
+		if _, err := decoder.Token(); err != nil {
+			return nil, err
+		}
+		return &jsonRowReader{decoder: decoder}, nil
+	case "ndjson":
+		return &jsonRowReader{decoder: json.NewDecoder(bufio.NewReader(file))}, nil
+	case "csv":
+		reader := csv.NewReader(bufio.NewReader(file))
+		header, err := reader.Read()
+		if err != nil {
+			return nil, err
+		}
+		// Номер поля структуры для каждой колонки заголовка
+		fields := make([]int, len(header))
+		for i, column := range header {
+			fields[i] = -1
+			for j := 0; j < table.Type.NumField(); j++ {
+				if table.Type.Field(j).Tag.Get("json") == column {
+					fields[i] = j
+				}
+			}
+			if fields[i] < 0 {
+				return nil, fmt.Errorf("неизвестная колонка %q", column)
+			}
+		}
+		return &csvRowReader{r: reader, columns: header, fields: fields}, nil
+	case "parquet":
+		return &parquetRowReader{r: parquet.NewReader(file, parquet.SchemaOf(table.new()))}, nil
+	}
+	return nil, fmt.Errorf("неизвестный формат %q", format)
+}
+
+// JSON: один массив на таблицу, элементы пишутся по одному
+type jsonRowWriter struct {
+	w     *bufio.Writer
+	count int
+}
+
+func (j *jsonRowWriter) Write(row interface{}) error {
+	data, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+
+	separator := ",\n"
+	if j.count == 0 {
+		separator = "[\n"
+	}
+	j.count++
+
+	j.w.WriteString(separator)
+	_, err = j.w.Write(data)
+	return err
+}
+
+func (j *jsonRowWriter) Close() error {
+	if j.count == 0 {
+		j.w.WriteString("[")
+	}
+	j.w.WriteString("\n]\n")
+	return j.w.Flush()
+}
+
+type ndjsonRowWriter struct {
+	w       *bufio.Writer
+	encoder *json.Encoder
+}
+
+func (n *ndjsonRowWriter) Write(row interface{}) error { return n.encoder.Encode(row) }
+func (n *ndjsonRowWriter) Close() error                { return n.w.Flush() }
+
+// Для JSON и NDJSON: декодер читает элементы массива или строки подряд
+type jsonRowReader struct {
+	decoder *json.Decoder
+}
+
+func (j *jsonRowReader) Read(row interface{}) error {
+	if !j.decoder.More() {
+		return io.EOF
+	}
+	return j.decoder.Decode(row)
+}
+
+func (j *jsonRowReader) Close() error { return nil }
+
+type csvRowWriter struct {
+	w       *csv.Writer
+	columns []string
+}
+
+func (c *csvRowWriter) Write(row interface{}) error {
+	value := reflect.ValueOf(row).Elem()
+
+	record := make([]string, value.NumField())
+	for i := range record {
+		record[i] = formatCSVValue(value.Field(i))
+	}
+	return c.w.Write(record)
+}
+
+func (c *csvRowWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type csvRowReader struct {
+	r       *csv.Reader
+	columns []string
+	fields  []int
+}
+
+func (c *csvRowReader) Read(row interface{}) error {
+	record, err := c.r.Read()
+	if err != nil {
+		return err
+	}
+
+	value := reflect.ValueOf(row).Elem()
+	for i, column := range c.columns {
+		if err := parseCSVValue(value.Field(c.fields[i]), record[i]); err != nil {
+			return fmt.Errorf("колонка %q: %w", column, err)
+		}
+	}
+	return nil
+}
+
+func (c *csvRowReader) Close() error { return nil }
+
+func formatCSVValue(v reflect.Value) string {
+	if t, ok := v.Interface().(time.Time); ok {
+		return t.Format(time.RFC3339Nano)
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	}
+
+	// Остальное (gorm.DeletedAt, sql.Null*) - через JSON
+	data, _ := json.Marshal(v.Interface())
+	return string(data)
+}
+
+func parseCSVValue(v reflect.Value, s string) error {
+	if _, ok := v.Interface().(time.Time); ok {
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err == nil {
+			v.Set(reflect.ValueOf(t))
+		}
+		return err
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	default:
+		return json.Unmarshal([]byte(s), v.Addr().Interface())
+	}
+	return nil
+}
+
+type parquetRowWriter struct {
+	w *parquet.Writer
+}
+
+func (p *parquetRowWriter) Write(row interface{}) error { return p.w.Write(row) }
+func (p *parquetRowWriter) Close() error                { return p.w.Close() }
+
+type parquetRowReader struct {
+	r *parquet.Reader
+}
+
+func (p *parquetRowReader) Read(row interface{}) error { return p.r.Read(row) }
+func (p *parquetRowReader) Close() error               { return p.r.Close() }
+
+// go run . export -format=ndjson -dir=dump [users posts ...]
+func exportCommand(db *gorm.DB, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	format := flags.String("format", "json", "json, ndjson, csv или parquet")
+	dir := flags.String("dir", "dump", "каталог для файлов")
+	flags.Parse(args)
+
+	tables, err := selectTransferTables(db, flags.Args())
+	if err != nil {
+		return err
+	}
+	return exportTables(db, tables, *dir, *format)
+}
+
+// go run . import -format=ndjson -dir=dump [users posts ...]
+func importCommand(db *gorm.DB, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	format := flags.String("format", "json", "json, ndjson, csv или parquet")
+	dir := flags.String("dir", "dump", "каталог с файлами")
+	flags.Parse(args)
+
+	tables, err := selectTransferTables(db, flags.Args())
+	if err != nil {
+		return err
+	}
+
+	// Все таблицы загружаются в одной транзакции
+	return db.Transaction(func(tx *gorm.DB) error {
+		return importTables(tx, tables, *dir, *format)
+	})
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var transferTestModels = []interface{}{&User{}, &UserAddress{}, &UserCompany{}, &Post{}, &Comment{}, &OutboxEvent{}}
+
+func seedTransfer() []User {
+	return []User{
+		{
+			Name: "Leanne Graham", Email: "leanne@example.com", Website: "hildegard.org",
+			Address: UserAddress{Street: "Kulas Light", City: "Gwenborough"},
+			Company: UserCompany{Name: "Romaguera-Crona", CatchPhrase: "Multi-layered, \"client-server\""},
+			Posts: []Post{
+				{Title: "first", Body: "line 1\nline 2", Comments: []Comment{{Name: "c1", Email: "c1@example.com", Body: "comment, with comma"}}},
+				{Title: "second"},
+			},
+		},
+		{Name: "Ervin Howell", Email: "ervin@example.com"},
+	}
+}
+
+func TestTransferRoundTrip(t *testing.T) {
+	for _, format := range []string{"json", "ndjson", "csv", "parquet"} {
+		t.Run(format, func(t *testing.T) {
+			source := openTestDB(t, transferTestModels...)
+			users := seedTransfer()
+			if err := source.Create(&users).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			dir := t.TempDir()
+			if err := exportCommand(source, []string{"-format", format, "-dir", dir}); err != nil {
+				t.Fatal(err)
+			}
+
+			target := openTestDB(t, transferTestModels...)
+			if err := importCommand(target, []string{"-format", format, "-dir", dir}); err != nil {
+				t.Fatal(err)
+			}
+
+			var want, got []User
+			source.Preload("Address").Preload("Company").Preload("Posts.Comments").Order("id").Find(&want)
+			target.Preload("Address").Preload("Company").Preload("Posts.Comments").Order("id").Find(&got)
+			if len(got) != 2 || !reflect.DeepEqual(got, want) {
+				t.Errorf("загружено %+v\nожидалось %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestTransferTablesSubset(t *testing.T) {
+	source := openTestDB(t, transferTestModels...)
+	users := seedTransfer()
+	if err := source.Create(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if err := exportCommand(source, []string{"-format", "ndjson", "-dir", dir, "users"}); err != nil {
+		t.Fatal(err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(files) != 1 || filepath.Base(files[0]) != "users.ndjson" {
+		t.Fatalf("выгружены файлы %v", files)
+	}
+
+	target := openTestDB(t, transferTestModels...)
+	if err := importCommand(target, []string{"-format", "ndjson", "-dir", dir, "users"}); err != nil {
+		t.Fatal(err)
+	}
+	var userCount, postCount int64
+	target.Model(&User{}).Count(&userCount)
+	target.Model(&Post{}).Count(&postCount)
+	if userCount != 2 || postCount != 0 {
+		t.Errorf("пользователей %d, постов %d", userCount, postCount)
+	}
+
+	// Порядок имен не важен, таблицы идут в порядке внешних ключей
+	tables, err := selectTransferTables(source, []string{"comments", "users"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) != 2 || tables[0].Name != "users" || tables[1].Name != "comments" {
+		t.Errorf("выбраны %+v", tables)
+	}
+
+	if _, err := selectTransferTables(source, []string{"users", "missing"}); err == nil {
+		t.Error("неизвестная таблица без ошибки")
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Проверка моделей перед сохранением.
+// Правила задаются тегом validate:"required,email,max=100",
+// дополнительные проверки - методом Validate() error.
+// Хуки BeforeCreate/BeforeUpdate возвращают *ValidationError со списком ошибок по полям
+// (validationerror.go).
+
+type validator interface {
+	Validate() error
+}
+
+// Проверка всех полей структуры
+func validateStruct(value interface{}) error {
+	result := &ValidationError{}
+
+	v := reflect.Indirect(reflect.ValueOf(value))
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if rules := field.Tag.Get("validate"); rules != "" {
+			validateValue(result, field.Name, rules, v.Field(i).Interface())
+		}
+	}
+
+	mergeValidate(result, value)
+	return result.OrNil()
+}
+
+// Проверка при обновлении: только поля, которые реально меняются
+func validateUpdate(tx *gorm.DB) error {
+	result := &ValidationError{}
+	schema := tx.Statement.Schema
+
+	switch dest := tx.Statement.Dest.(type) {
+	case map[string]interface{}:
+		// Update("Name", ...) и Updates(map[string]interface{}{...})
+		for key, value := range dest {
+			if field := schema.LookUpField(key); field != nil {
+				if rules := field.Tag.Get("validate"); rules != "" {
+					validateValue(result, field.Name, rules, value)
+				}
+			}
+		}
+	default:
+		// Save - вся модель; Updates(struct) - только ненулевые поля
+		v := reflect.Indirect(reflect.ValueOf(dest))
+		if v.Kind() != reflect.Struct || v.Type() != schema.ModelType {
+			return nil
+		}
+		save := tx.Statement.Dest == tx.Statement.Model
+		for _, field := range schema.Fields {
+			rules := field.Tag.Get("validate")
+			if rules == "" {
+				continue
+			}
+			value, zero := field.ValueOf(tx.Statement.Context, v)
+			if save || !zero {
+				validateValue(result, field.Name, rules, value)
+			}
+		}
+		if save {
+			mergeValidate(result, dest)
+		}
+	}
+
+	return result.OrNil()
+}
+
+func mergeValidate(result *ValidationError, value interface{}) {
+	custom, ok := value.(validator)
+	if !ok {
+		return
+	}
+
+	err := custom.Validate()
+	var validationErr *ValidationError
+	switch {
+	case err == nil:
+	case errors.As(err, &validationErr):
+		result.Errors = append(result.Errors, validationErr.Errors...)
+	default:
+		result.Add("", err.Error())
+	}
+}
+
+func validateValue(result *ValidationError, field, rules string, value interface{}) {
+	v := reflect.Indirect(reflect.ValueOf(value))
+	empty := !v.IsValid() || v.IsZero()
+
+	for _, rule := range strings.Split(rules, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+
+		switch name {
+		case "required":
+			if empty {
+				result.Add(field, "обязательное поле")
+				return
+			}
+		case "email":
+			if s, ok := value.(string); ok && s != "" {
+				if address, err := mail.ParseAddress(s); err != nil || address.Address != s {
+					result.Add(field, "некорректный email")
+				}
+			}
+		case "url":
+			if s, ok := value.(string); ok && s != "" {
+				if u, err := url.Parse(withScheme(s)); err != nil || u.Host == "" {
+					result.Add(field, "некорректный адрес сайта")
+				}
+			}
+		case "min", "max":
+			limit, err := strconv.ParseFloat(arg, 64)
+			if err != nil || empty {
+				continue
+			}
+			size, unit := measure(v)
+			if name == "min" && size < limit {
+				result.Add(field, fmt.Sprintf("минимум %s%s", arg, unit))
+			}
+			if name == "max" && size > limit {
+				result.Add(field, fmt.Sprintf("максимум %s%s", arg, unit))
+			}
+		}
+	}
+}
+
+// Длина строки или значение числа
+func measure(v reflect.Value) (float64, string) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(len([]rune(v.String()))), " символов"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), ""
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), ""
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), ""
+	}
+	return 0, ""
+}
+
+func withScheme(s string) string {
+	if strings.Contains(s, "://") {
+		return s
+	}
+	return "http://" + s
+}
+
+// Хуки моделей
+
+func (u *User) BeforeCreate(tx *gorm.DB) error    { return validateStruct(u) }
+func (u *User) BeforeUpdate(tx *gorm.DB) error    { return validateUpdate(tx) }
+func (p *Post) BeforeCreate(tx *gorm.DB) error    { return validateStruct(p) }
+func (p *Post) BeforeUpdate(tx *gorm.DB) error    { return validateUpdate(tx) }
+func (c *Comment) BeforeCreate(tx *gorm.DB) error { return validateStruct(c) }
+func (c *Comment) BeforeUpdate(tx *gorm.DB) error { return validateUpdate(tx) }
+
+// Ответ API: 422 со списком ошибок по полям
+func writeValidationError(w http.ResponseWriter, err error) bool {
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		return false
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(validationErr)
+	return true
+}
+
+func exampleValidation(db *gorm.DB) {
+	user := User{Name: "", Email: "not-an-email"}
+	if err := db.Create(&user).Error; err != nil {
+		printValidationError(err)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Ошибки проверки по полям. Хуки моделей возвращают *ValidationError,
+// HTTP API Project 2 отдает его как 422 с тем же JSON (writeValidationError).
+//
+// Файл общий с Project 1 и Project 4: там validationerror.go - ссылка на этот файл.
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type ValidationError struct {
+	Errors []FieldError `json:"errors"`
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, fieldErr := range e.Errors {
+		messages[i] = fieldErr.Field + ": " + fieldErr.Message
+	}
+	return "ошибка проверки: " + strings.Join(messages, "; ")
+}
+
+func (e *ValidationError) Add(field, message string) {
+	e.Errors = append(e.Errors, FieldError{Field: field, Message: message})
+}
+
+// nil, если ошибок нет
+func (e *ValidationError) OrNil() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Вывод ошибок проверки в консоль
+func printValidationError(err error) {
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		fmt.Println("Ошибка:", err)
+		return
+	}
+
+	fmt.Println("Ошибки проверки:")
+	for _, fieldErr := range validationErr.Errors {
+		fmt.Printf("  %s: %s\n", fieldErr.Field, fieldErr.Message)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+// Модели Blog1 и Blog2 для create-model.go и openapi.go:
+//   go run create-model.go user.go blog.go
+
+type Author struct {
+  Name  string
+  Email string
+}
+
+type Blog1 struct {
+  ID      int
+  Author  Author `gorm:"embedded"`
+  Upvotes int32
+}
+/* эквивалентно
+type Blog struct {
+  ID      int64
+  Name    string
+  Email   string
+  Upvotes int32
+}
+*/
+
+type Blog2 struct {
+  ID      int
+  Author  Author `gorm:"embedded;embeddedPrefix:author_"`
+  Upvotes int32
+}
+/* эквивалентно
+type Blog struct {
+  ID          int64
+  AuthorName  string
+  AuthorEmail string
+  Upvotes     int32
+}
+*/
@@ -0,0 +1,49 @@
+package main
+
+import (
+  "fmt"
+  "time"
+
+  "gorm.io/driver/postgres"
+  "gorm.io/gorm"
+)
+
+// Возраст, вычисляемый из даты рождения (модель и scopes - в user.go):
+//   go run computed-age.go user.go
+
+func main() {
+
+  dsn := "host=localhost user=postgres password=root dbname=golang port=5432 sslmode=disable"
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+  if err != nil {
+    panic("failed to connect database")
+  }
+
+  // Миграция схем
+  db.AutoMigrate(&User{})
+
+  now := time.Now().In(ageLocation)
+  db.Create(&[]User{
+    {Name: "Ann", Birthday: now.AddDate(-20, 0, 0)},
+    {Name: "Bob", Birthday: now.AddDate(-25, 0, 2)}, // 25 исполнится через 2 дня
+    {Name: "Kate", Birthday: now.AddDate(-40, -3, 0)},
+  })
+
+  {
+    // Пользователи 18-25 лет, от младших к старшим
+    var users []User
+    db.Scopes(AgedBetween(18, 25), OrderByAge(false)).Find(&users)
+    for _, user := range users {
+      fmt.Println(user.Name, user.Birthday.Format("2006-01-02"), user.Age)
+    }
+  }
+
+  {
+    // Дни рождения на этой неделе
+    var users []User
+    db.Scopes(BirthdayThisWeek).Find(&users)
+    for _, user := range users {
+      fmt.Println(user.Name, user.Birthday.Format("2006-01-02"), user.Age)
+    }
+  }
+}
@@ -1,66 +1,28 @@
 package main
 
 import (
-  "time"
-  
   "gorm.io/gorm"
   "gorm.io/driver/postgres"
 )
 
-type Author struct {
-  Name  string
-  Email string
-}
-
-
-type Blog1 struct {
-  ID      int
-  Author  Author `gorm:"embedded"`
-  Upvotes int32
-}
-/* эквивалентно
-type Blog struct {
-  ID    int64
-    Name  string
-    Email string
-  Upvotes  int32
-}
-*/
-
-
-
-
-type Blog2 struct {
-ID      int
-Author  Author `gorm:"embedded;embeddedPrefix:author_"`
-Upvotes int32
-}
-/* эквивалентно
-type Blog struct {
-  ID          int64
-  AuthorName  string
-  AuthorEmail string
-  Upvotes     int32
-}
-*/
-
-
+// Author, Blog1, Blog2 - в blog.go:
+//   go run create-model.go user.go blog.go
 
+/* User (user.go) - на основе gorm.Model:
 type User struct {
   gorm.Model
-  Name string
-  Age  uint8
+  Name     string
   Birthday time.Time
+  Age      int `gorm:"-"` // вычисляется из Birthday, в таблицу не пишется
 }
-/* эквивалентно
+эквивалентно
 type User struct {
   ID        uint           `gorm:"primaryKey"`
   CreatedAt time.Time
   UpdatedAt time.Time
   DeletedAt gorm.DeletedAt `gorm:"index"`
-  Name string
-  Age  uint8
-  Birthday time.Time
+  Name      string
+  Birthday  time.Time
 }
 */
 
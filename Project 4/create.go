@@ -3,19 +3,82 @@ package main
 import (
 	"time"
   "fmt"
+  "reflect"
+  "strings"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
+// Модель User с вычисляемым возрастом - в user.go:
+//   go run create.go user.go validationerror.go
 
-type User struct {
-  gorm.Model
-  Name string
-  Age  uint8
-  Birthday time.Time
+// Проверка одного поля User; field - имя поля в модели.
+// Ошибки - *ValidationError (validationerror.go).
+func validateUserField(result *ValidationError, field string, value interface{}) {
+  switch field {
+  case "Name":
+    if name, ok := value.(string); ok && strings.TrimSpace(name) == "" {
+      result.Add(field, "обязательное поле")
+    }
+  case "Birthday":
+    birthday, ok := value.(time.Time)
+    if pointer, isPointer := value.(*time.Time); isPointer && pointer != nil {
+      birthday, ok = *pointer, true
+    }
+    switch {
+    case !ok:
+    case birthday.IsZero():
+      result.Add(field, "обязательное поле")
+    case birthday.After(time.Now()):
+      result.Add(field, "дата рождения в будущем")
+    }
+  }
+}
+
+func (u *User) Validate() error {
+  result := &ValidationError{}
+  validateUserField(result, "Name", u.Name)
+  validateUserField(result, "Birthday", u.Birthday)
+  return result.OrNil()
 }
 
+func (u *User) BeforeCreate(tx *gorm.DB) error {
+  return u.Validate()
+}
+
+// При обновлении проверяются только новые значения (как у Product в product.go):
+// Update("name", ...) и Updates(map) - по имени поля или столбца,
+// Updates(User{...}) - ненулевые поля, Save - вся модель
+func (u *User) BeforeUpdate(tx *gorm.DB) error {
+  if tx.Statement.Dest == tx.Statement.Model {
+    return u.Validate()
+  }
+
+  result := &ValidationError{}
+  schema := tx.Statement.Schema
+
+  switch dest := tx.Statement.Dest.(type) {
+  case map[string]interface{}:
+    for key, value := range dest {
+      if field := schema.LookUpField(key); field != nil {
+        validateUserField(result, field.Name, value)
+      }
+    }
+  default:
+    v := reflect.Indirect(reflect.ValueOf(dest))
+    if v.Kind() != reflect.Struct || v.Type() != schema.ModelType {
+      return nil
+    }
+    for _, field := range schema.Fields {
+      if value, zero := field.ValueOf(tx.Statement.Context, v); !zero {
+        validateUserField(result, field.Name, value)
+      }
+    }
+  }
+
+  return result.OrNil()
+}
 
 func main() {
 
@@ -27,7 +90,7 @@ func main() {
 
 
   {
-    user := User{Name: "Jinzhu", Age: 18, Birthday: time.Now()}
+    user := User{Name: "Jinzhu", Birthday: time.Now().AddDate(-18, 0, 0)}
     result := db.Create(&user) // передаем указатель на данные в Create
     /*
     user.ID             // возвращает первичный ключ добавленной записи
@@ -39,12 +102,16 @@ func main() {
     fmt.Println("ID", user.ID)
     fmt.Println("Error", result.Error)
     fmt.Println("RowsAffected", result.RowsAffected)
+
+    // Возраст не хранится: вычисляется из Birthday при чтении (AfterFind)
+    db.First(&user, user.ID)
+    fmt.Println("Age", user.Age)
   }
 
   {
     users := []User{
-      User{Name: "Jinzhu", Age: 18, Birthday: time.Now()},
-      User{Name: "Jackson", Age: 19, Birthday: time.Now()},
+      User{Name: "Jinzhu", Birthday: time.Now().AddDate(-18, 0, 0)},
+      User{Name: "Jackson", Birthday: time.Now().AddDate(-19, 0, 0)},
     }
   
     result := db.Create(users) // передайте фрагмент, чтобы вставить несколько строк
@@ -57,4 +124,12 @@ func main() {
       fmt.Println("ID", user.ID)
     }
   }
+
+  {
+    // Проверка: дата рождения в будущем
+    user := User{Name: "Future", Birthday: time.Now().AddDate(1, 0, 0)}
+    if err := db.Create(&user).Error; err != nil {
+      printValidationError(err)
+    }
+  }
 }
\ No newline at end of file
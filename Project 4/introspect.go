@@ -0,0 +1 @@
+../Project 2/introspect.go
\ No newline at end of file
@@ -0,0 +1,184 @@
+package main
+
+import (
+  "errors"
+  "fmt"
+  "sync"
+  "time"
+
+  "github.com/jackc/pgx/v5/pgconn"
+  "gorm.io/driver/postgres"
+  "gorm.io/gorm"
+  "gorm.io/gorm/clause"
+)
+
+// Пессимистические блокировки строк, используются внутри транзакции:
+//   tx.Scopes(ForUpdate).First(&product, id)
+
+// SELECT ... FOR UPDATE - ждать, пока строку освободят
+func ForUpdate(db *gorm.DB) *gorm.DB {
+  return db.Clauses(clause.Locking{Strength: "UPDATE"})
+}
+
+// SELECT ... FOR UPDATE SKIP LOCKED - пропустить занятые строки
+func ForUpdateSkipLocked(db *gorm.DB) *gorm.DB {
+  return db.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+}
+
+// SELECT ... FOR UPDATE NOWAIT - сразу ошибка, если строка занята
+func ForUpdateNoWait(db *gorm.DB) *gorm.DB {
+  return db.Clauses(clause.Locking{Strength: "UPDATE", Options: "NOWAIT"})
+}
+
+var ErrLocked = errors.New("строка заблокирована другой транзакцией")
+
+// Ошибка Postgres 55P03 (lock_not_available) - это ErrLocked
+func lockError(err error) error {
+  var pgErr *pgconn.PgError
+  if errors.As(err, &pgErr) && pgErr.Code == "55P03" {
+    return ErrLocked
+  }
+  return err
+}
+
+// Изменение цены: строка товара блокируется до конца транзакции,
+// параллельные изменения ждут и читают уже новую цену
+func changePrice(db *gorm.DB, id uint, delta int) error {
+  return db.Transaction(func(tx *gorm.DB) error {
+    var product Product
+    if err := tx.Scopes(ForUpdate).First(&product, id).Error; err != nil {
+      return err
+    }
+
+    price := int(product.Price) + delta
+    if price <= 0 {
+      return fmt.Errorf("цена не может стать %d", price)
+    }
+    return tx.Model(&product).Update("Price", price).Error
+  })
+}
+
+// То же, но без ожидания: если товар уже меняют - ErrLocked
+func changePriceNoWait(db *gorm.DB, id uint, delta int) error {
+  return db.Transaction(func(tx *gorm.DB) error {
+    var product Product
+    if err := tx.Scopes(ForUpdateNoWait).First(&product, id).Error; err != nil {
+      return lockError(err)
+    }
+    return tx.Model(&product).Update("Price", int(product.Price)+delta).Error
+  })
+}
+
+// Очередь задач на SKIP LOCKED: каждый обработчик забирает свободную задачу,
+// занятые другими обработчиками строки пропускаются
+type Job struct {
+  ID          uint `gorm:"primaryKey"`
+  ProductID   uint
+  Delta       int
+  Status      string `gorm:"index;default:pending"`
+  Worker      string
+  ProcessedAt *time.Time
+}
+
+// Обработка одной задачи; false - свободных задач нет
+func processNextJob(db *gorm.DB, worker string) (bool, error) {
+  found := false
+
+  err := db.Transaction(func(tx *gorm.DB) error {
+    var job Job
+    result := tx.Scopes(ForUpdateSkipLocked).
+      Where("status = ?", "pending").
+      Order("id").
+      Limit(1).
+      Find(&job)
+    if result.Error != nil || result.RowsAffected == 0 {
+      return result.Error
+    }
+    found = true
+
+    // Задача и цена товара меняются в одной транзакции
+    err := tx.Model(&Product{}).
+      Where("id = ?", job.ProductID).
+      Update("Price", gorm.Expr("price + ?", job.Delta)).Error
+    if err != nil {
+      return err
+    }
+
+    now := time.Now()
+    return tx.Model(&job).Updates(Job{Status: "done", Worker: worker, ProcessedAt: &now}).Error
+  })
+
+  return found, err
+}
+
+func runWorkers(db *gorm.DB, count int) {
+  var wg sync.WaitGroup
+
+  for i := 1; i <= count; i++ {
+    wg.Add(1)
+    go func(worker string) {
+      defer wg.Done()
+      processed := 0
+      for {
+        found, err := processNextJob(db, worker)
+        if err != nil {
+          fmt.Println(worker, "ошибка:", err)
+          return
+        }
+        if !found {
+          break
+        }
+        processed++
+      }
+      fmt.Println(worker, "обработал задач:", processed)
+    }(fmt.Sprintf("worker-%d", i))
+  }
+
+  wg.Wait()
+}
+
+func main() {
+
+  dsn := "host=localhost user=postgres password=root dbname=golang port=5432 sslmode=disable"
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+  if err != nil {
+    panic("failed to connect database")
+  }
+
+  // Миграция схем
+  db.AutoMigrate(&Product{}, &Job{})
+
+  // Код уникален - при повторном запуске берем уже созданный товар
+  var product Product
+  db.Where(Product{Code: "L42"}).Attrs(Product{Price: 1000}).FirstOrCreate(&product)
+
+  // Блокировка с ожиданием
+  if err := changePrice(db, product.ID, -100); err != nil {
+    fmt.Println("Ошибка:", err)
+  }
+
+  // NOWAIT: пока первая транзакция держит строку, вторая сразу получает ErrLocked
+  db.Transaction(func(tx *gorm.DB) error {
+    var locked Product
+    tx.Scopes(ForUpdate).First(&locked, product.ID)
+
+    if err := changePriceNoWait(db, product.ID, 50); errors.Is(err, ErrLocked) {
+      fmt.Println("NOWAIT:", err)
+    }
+    return nil
+  })
+
+  // Очередь: 100 задач, 4 обработчика, каждая задача выполняется ровно один раз
+  jobs := make([]Job, 100)
+  for i := range jobs {
+    jobs[i] = Job{ProductID: product.ID, Delta: 1}
+  }
+  db.Create(&jobs)
+
+  runWorkers(db, 4)
+
+  var pending int64
+  db.Model(&Job{}).Where("status = ?", "pending").Count(&pending)
+  db.First(&product, product.ID)
+  fmt.Println("Осталось задач:", pending, "Цена:", product.Price) // 0, 1000
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+  "errors"
+  "fmt"
+  "os"
+  "strings"
+  "sync"
+  "testing"
+
+  "github.com/jackc/pgx/v5/pgconn"
+  "gorm.io/driver/postgres"
+  "gorm.io/gorm"
+  "gorm.io/gorm/logger"
+)
+
+// В каталоге у каждого примера своя main, поэтому файлы перечисляются явно:
+//   go test locking_test.go locking.go product.go optimistic.go validationerror.go
+// Тесты блокировок - на Postgres из TEST_POSTGRES_DSN, без него пропускаются.
+
+func TestLockingClauses(t *testing.T) {
+  // DryRun: SQL строится без подключения
+  db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+    DryRun:               true,
+    DisableAutomaticPing: true,
+    Logger:               logger.Discard,
+  })
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  for suffix, scope := range map[string]func(*gorm.DB) *gorm.DB{
+    "FOR UPDATE":             ForUpdate,
+    "FOR UPDATE SKIP LOCKED": ForUpdateSkipLocked,
+    "FOR UPDATE NOWAIT":      ForUpdateNoWait,
+  } {
+    sql := db.Scopes(scope).First(&Product{}, 1).Statement.SQL.String()
+    if !strings.HasSuffix(sql, suffix) {
+      t.Errorf("ожидалось %q: %s", suffix, sql)
+    }
+  }
+}
+
+func TestLockError(t *testing.T) {
+  locked := fmt.Errorf("select: %w", &pgconn.PgError{Code: "55P03"})
+  if err := lockError(locked); err != ErrLocked {
+    t.Errorf("55P03: %v", err)
+  }
+
+  for _, err := range []error{&pgconn.PgError{Code: "40P01"}, gorm.ErrRecordNotFound} {
+    if got := lockError(err); got != err {
+      t.Errorf("%v: %v", err, got)
+    }
+  }
+  if lockError(nil) != nil {
+    t.Error("lockError(nil) != nil")
+  }
+}
+
+func openLockingTestDB(t *testing.T) *gorm.DB {
+  t.Helper()
+  dsn := os.Getenv("TEST_POSTGRES_DSN")
+  if dsn == "" {
+    t.Skip("TEST_POSTGRES_DSN не задан")
+  }
+
+  db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+  if err != nil {
+    t.Fatal(err)
+  }
+  if err := db.AutoMigrate(&Product{}, &Job{}); err != nil {
+    t.Fatal(err)
+  }
+  if err := db.Exec("TRUNCATE products, jobs RESTART IDENTITY").Error; err != nil {
+    t.Fatal(err)
+  }
+  t.Cleanup(func() {
+    if sqlDB, err := db.DB(); err == nil {
+      sqlDB.Close()
+    }
+  })
+  return db
+}
+
+func createLockingProduct(t *testing.T, db *gorm.DB, price uint) Product {
+  t.Helper()
+  product := Product{Code: "L42", Price: price}
+  if err := db.Create(&product).Error; err != nil {
+    t.Fatal(err)
+  }
+  return product
+}
+
+func TestChangePriceConcurrent(t *testing.T) {
+  db := openLockingTestDB(t)
+  product := createLockingProduct(t, db, 1000)
+
+  // FOR UPDATE: каждая транзакция читает цену после предыдущей
+  var wg sync.WaitGroup
+  errs := make(chan error, 10)
+  for i := 0; i < 10; i++ {
+    wg.Add(1)
+    go func() {
+      defer wg.Done()
+      errs <- changePrice(db, product.ID, 10)
+    }()
+  }
+  wg.Wait()
+  close(errs)
+  for err := range errs {
+    if err != nil {
+      t.Fatal(err)
+    }
+  }
+
+  db.First(&product, product.ID)
+  if product.Price != 1100 {
+    t.Errorf("цена %d, ожидалось 1100: изменения потеряны", product.Price)
+  }
+
+  if err := changePrice(db, product.ID, -2000); err == nil {
+    t.Error("цена стала отрицательной")
+  }
+}
+
+func TestChangePriceNoWait(t *testing.T) {
+  db := openLockingTestDB(t)
+  product := createLockingProduct(t, db, 1000)
+
+  db.Transaction(func(tx *gorm.DB) error {
+    var locked Product
+    if err := tx.Scopes(ForUpdate).First(&locked, product.ID).Error; err != nil {
+      t.Fatal(err)
+    }
+
+    if err := changePriceNoWait(db, product.ID, 50); !errors.Is(err, ErrLocked) {
+      t.Errorf("строка занята, но ошибка %v", err)
+    }
+    return nil
+  })
+
+  // Блокировка снята
+  if err := changePriceNoWait(db, product.ID, 50); err != nil {
+    t.Fatal(err)
+  }
+  db.First(&product, product.ID)
+  if product.Price != 1050 {
+    t.Errorf("цена %d, ожидалось 1050", product.Price)
+  }
+}
+
+func TestJobQueue(t *testing.T) {
+  db := openLockingTestDB(t)
+  product := createLockingProduct(t, db, 1000)
+
+  jobs := make([]Job, 50)
+  for i := range jobs {
+    jobs[i] = Job{ProductID: product.ID, Delta: 1}
+  }
+  if err := db.Create(&jobs).Error; err != nil {
+    t.Fatal(err)
+  }
+
+  runWorkers(db, 4)
+
+  // SKIP LOCKED: каждая задача выполнена ровно один раз
+  var pending, done int64
+  db.Model(&Job{}).Where("status = ?", "pending").Count(&pending)
+  db.Model(&Job{}).Where("status = ? AND worker <> '' AND processed_at IS NOT NULL", "done").Count(&done)
+  db.First(&product, product.ID)
+  if pending != 0 || done != 50 || product.Price != 1050 {
+    t.Errorf("осталось %d, выполнено %d, цена %d; ожидалось 0, 50, 1050", pending, done, product.Price)
+  }
+
+  if found, err := processNextJob(db, "worker-test"); found || err != nil {
+    t.Errorf("пустая очередь: found=%v, err=%v", found, err)
+  }
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+  "encoding/json"
+  "flag"
+  "os"
+
+  "gorm.io/gorm/schema"
+)
+
+// Схемы OpenAPI 3 / JSON Schema для моделей Project 4 (разбор через GORM,
+// подключение к базе не нужно). Генератор общий с Project 2:
+// schemagen.go - ссылка на ../Project 2/schemagen.go, Product - в product.go,
+// Author, Blog1, Blog2 - в blog.go.
+//   go run openapi.go schemagen.go product.go blog.go optimistic.go validationerror.go > openapi.json
+//   go run openapi.go schemagen.go product.go blog.go optimistic.go validationerror.go -format=jsonschema > schema.json
+//
+// Поля gorm.Model - на верхнем уровне (как в encoding/json),
+// Author с gorm:"embedded" - вложенный объект, а имя столбца
+// (с embeddedPrefix: author_name) - в расширении x-gorm-column.
+
+func main() {
+
+  format := flag.String("format", "openapi", "openapi или jsonschema")
+  flag.Parse()
+
+  generator := newSchemaGenerator(schema.NamingStrategy{}, *format == "openapi")
+  for _, model := range []interface{}{&Product{}, &Blog1{}, &Blog2{}} {
+    if err := generator.add(model); err != nil {
+      panic(err)
+    }
+  }
+
+  document := generator.openAPIDocument("Project 4")
+  if *format != "openapi" {
+    document = generator.jsonSchemaDocument("Project 4")
+  }
+
+  encoder := json.NewEncoder(os.Stdout)
+  encoder.SetIndent("", "  ")
+  encoder.Encode(document)
+}
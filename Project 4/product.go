@@ -0,0 +1,93 @@
+package main
+
+import (
+  "reflect"
+  "regexp"
+
+  "gorm.io/gorm"
+)
+
+// Модель Product для quick-start.go, locking.go, openapi.go и schema-check.go.
+// Version - из optimistic.go, ошибки проверки - из validationerror.go:
+//   go run locking.go product.go optimistic.go validationerror.go
+
+type Product struct {
+  gorm.Model
+  Code    string  `gorm:"size:32;not null;uniqueIndex:idx_products_code,where:deleted_at IS NULL"` // уникален среди неудаленных
+  Price   uint    `gorm:"not null;check:chk_products_price,price > 0"`
+  Version Version `gorm:"not null;default:1"` // оптимистическая блокировка (optimistic.go)
+}
+
+var productCode = regexp.MustCompile(`^[A-Z][0-9]+$`)
+
+// Проверка одного поля Product; field - имя поля в модели.
+// Ошибки - *ValidationError (validationerror.go).
+func validateProductField(result *ValidationError, field string, value interface{}) {
+  switch field {
+  case "Code":
+    if code, ok := value.(string); ok && !productCode.MatchString(code) {
+      result.Add(field, "код должен быть вида D42")
+    }
+  case "Price":
+    if price, ok := uintValue(value); ok && price == 0 {
+      result.Add(field, "цена должна быть больше нуля")
+    }
+  }
+}
+
+// Значение из Update("Price", 200) или Updates(map...) как целое без знака.
+// Отрицательное число - 0 (не пройдет проверку), не число (gorm.Expr) - false.
+func uintValue(value interface{}) (uint64, bool) {
+  v := reflect.Indirect(reflect.ValueOf(value))
+  switch {
+  case v.CanUint():
+    return v.Uint(), true
+  case v.CanInt():
+    return uint64(max(v.Int(), 0)), true
+  }
+  return 0, false
+}
+
+func (p *Product) Validate() error {
+  result := &ValidationError{}
+  validateProductField(result, "Code", p.Code)
+  validateProductField(result, "Price", p.Price)
+  return result.OrNil()
+}
+
+func (p *Product) BeforeCreate(tx *gorm.DB) error {
+  return p.Validate()
+}
+
+// При обновлении проверяются только новые значения:
+// Update("price", ...) и Updates(map) - по имени поля или столбца,
+// Updates(Product{...}) - ненулевые поля, Save - вся модель
+func (p *Product) BeforeUpdate(tx *gorm.DB) error {
+  if tx.Statement.Dest == tx.Statement.Model {
+    return p.Validate()
+  }
+
+  result := &ValidationError{}
+  schema := tx.Statement.Schema
+
+  switch dest := tx.Statement.Dest.(type) {
+  case map[string]interface{}:
+    for key, value := range dest {
+      if field := schema.LookUpField(key); field != nil {
+        validateProductField(result, field.Name, value)
+      }
+    }
+  default:
+    v := reflect.Indirect(reflect.ValueOf(dest))
+    if v.Kind() != reflect.Struct || v.Type() != schema.ModelType {
+      return nil
+    }
+    for _, field := range schema.Fields {
+      if value, zero := field.ValueOf(tx.Statement.Context, v); !zero {
+        validateProductField(result, field.Name, value)
+      }
+    }
+  }
+
+  return result.OrNil()
+}
@@ -1,16 +1,13 @@
 package main
 
 import (
+  "errors"
+  "fmt"
+
   "gorm.io/gorm"
   "gorm.io/driver/postgres"
 )
 
-type Product struct {
-  gorm.Model
-  Code  string
-  Price uint
-}
-
 func main() {
 
   dsn := "host=localhost user=postgres password=root dbname=golang port=5432 sslmode=disable"
@@ -19,11 +16,19 @@ func main() {
     panic("failed to connect database")
   }
 
+  // Проверка версии при обновлении (оптимистическая блокировка)
+  db.Use(OptimisticLockPlugin{})
+
   // Миграция схем
   db.AutoMigrate(&Product{})
 
-  // Создание
-  db.Create(&Product{Code: "D42", Price: 100})
+  // Создание; при повторном запуске берется уже созданный товар
+  db.Where(Product{Code: "D42"}).Attrs(Product{Price: 100}).FirstOrCreate(&Product{})
+
+  // Проверка: некорректный код и нулевая цена не сохраняются
+  if err := db.Create(&Product{Code: "d-42", Price: 0}).Error; err != nil {
+    printValidationError(err)
+  }
 
   // Чтение
   var product Product
@@ -36,6 +41,14 @@ func main() {
   db.Model(&product).Updates(Product{Price: 200, Code: "F42"}) // non-zero fields
   db.Model(&product).Updates(map[string]interface{}{"Price": 250, "Code": "F43"})
 
+  // Обновление устаревшей копии: версия уже изменилась
+  var stale Product
+  db.First(&stale, product.ID)
+  db.Model(&product).Update("Price", 300)
+  if err := db.Model(&stale).Update("Price", 100).Error; errors.Is(err, ErrConflict) {
+    fmt.Println("Конфликт:", err)
+  }
+
   // Удаление - удаление товара
-  db.Delete(&product, 1)
+  db.Delete(&product)
 }
\ No newline at end of file
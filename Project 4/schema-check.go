@@ -0,0 +1,37 @@
+package main
+
+import (
+  "fmt"
+  "os"
+
+  "gorm.io/driver/postgres"
+  "gorm.io/gorm"
+)
+
+// Сверка модели Product с таблицей products. AutoMigrate только добавляет,
+// поэтому удаленные поля, смена типа или NOT NULL в базу не попадают.
+// Сверка общая с Project 2 (go run . schema check): schemadiff.go
+// и introspect.go - ссылки на файлы ../Project 2, Product - в product.go.
+//   go run schema-check.go schemadiff.go introspect.go product.go optimistic.go validationerror.go
+// Код выхода 1, если есть расхождения.
+
+func main() {
+
+  dsn := "host=localhost user=postgres password=root dbname=golang port=5432 sslmode=disable"
+  db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+  if err != nil {
+    panic("failed to connect database")
+  }
+
+  diffs, err := checkSchema(db, []interface{}{&Product{}})
+  if err != nil {
+    panic(err)
+  }
+  if len(diffs) == 0 {
+    fmt.Println("products: схема совпадает с моделью")
+    return
+  }
+
+  printSchemaDiffs(diffs)
+  os.Exit(1)
+}
@@ -0,0 +1 @@
+../Project 2/schemadiff.go
\ No newline at end of file
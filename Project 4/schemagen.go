@@ -0,0 +1 @@
+../Project 2/schemagen.go
\ No newline at end of file
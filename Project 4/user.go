@@ -0,0 +1,78 @@
+package main
+
+import (
+  "database/sql"
+  "time"
+  _ "time/tzdata"
+
+  "gorm.io/gorm"
+)
+
+// Модель User для create-model.go, create.go и computed-age.go:
+//   go run create.go user.go validationerror.go
+
+// Возраст не хранится, а вычисляется из Birthday:
+// в Go - при чтении (AfterFind), в SQL - для фильтрации и сортировки.
+// Вычисляемый столбец (GENERATED) в Postgres здесь не подходит:
+// возраст зависит от текущей даты, а выражение должно быть неизменяемым.
+type User struct {
+  gorm.Model
+  Name     string
+  Birthday time.Time
+  Age      int `gorm:"-"` // вычисляется, в таблицу не пишется
+}
+
+// Часовой пояс, в котором считается "сегодня"
+var ageLocation, _ = time.LoadLocation("Europe/Moscow")
+
+// Полных лет на дату now
+func yearsSince(birthday, now time.Time) int {
+  years := now.Year() - birthday.Year()
+  if now.Month() < birthday.Month() || (now.Month() == birthday.Month() && now.Day() < birthday.Day()) {
+    years--
+  }
+  return years
+}
+
+func (u *User) AfterFind(tx *gorm.DB) error {
+  u.Age = yearsSince(u.Birthday.In(ageLocation), time.Now().In(ageLocation))
+  return nil
+}
+
+// Возраст в SQL: даты рождения и "сегодня" переводятся в часовой пояс @tz
+const ageSQL = "DATE_PART('year', AGE((NOW() AT TIME ZONE @tz)::date, (birthday AT TIME ZONE @tz)::date))"
+
+// Пользователи в возрасте от min до max лет включительно
+func AgedBetween(min, max int) func(db *gorm.DB) *gorm.DB {
+  return func(db *gorm.DB) *gorm.DB {
+    return db.Where(ageSQL+" BETWEEN @min AND @max",
+      sql.Named("tz", ageLocation.String()), sql.Named("min", min), sql.Named("max", max))
+  }
+}
+
+// Сортировка по возрасту (по дате рождения в обратном порядке)
+func OrderByAge(desc bool) func(db *gorm.DB) *gorm.DB {
+  return func(db *gorm.DB) *gorm.DB {
+    if desc {
+      return db.Order("birthday ASC")
+    }
+    return db.Order("birthday DESC")
+  }
+}
+
+// День рождения на текущей неделе (пн-вс): годовщина даты рождения
+// в году начала или конца недели попадает в неделю.
+// + INTERVAL для 29 февраля в невисокосный год дает 28 февраля.
+const birthdayThisWeekSQL = `
+  EXISTS (
+    SELECT 1
+    FROM (SELECT DATE_TRUNC('week', NOW() AT TIME ZONE @tz)::date AS week_start) w,
+      LATERAL (VALUES (w.week_start), (w.week_start + 6)) AS y(day)
+    WHERE ((birthday AT TIME ZONE @tz)::date
+        + MAKE_INTERVAL(years => (EXTRACT(YEAR FROM y.day) - EXTRACT(YEAR FROM (birthday AT TIME ZONE @tz)))::int))::date
+      BETWEEN w.week_start AND w.week_start + 6
+  )`
+
+func BirthdayThisWeek(db *gorm.DB) *gorm.DB {
+  return db.Where(birthdayThisWeekSQL, sql.Named("tz", ageLocation.String()))
+}